@@ -5,23 +5,38 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Specter242/bootpokedex/internal/pokeapi"
+	"github.com/Specter242/bootpokedex/internal/pokecache"
 )
 
-// Make pokeClient a package variable that can be modified for testing
-var pokeClient pokeapi.APIClient = pokeapi.NewClient("https://pokeapi.co/api/v2")
+const pokeAPIBaseURL = "https://pokeapi.co/api/v2"
 
-func commandExit(arg string) error {
+// pokeCache is the response cache shared with pokeClient, kept here so the cache command can inspect it.
+// main sets it up along with pokeClient.
+var pokeCache *pokecache.Cache
+
+// pokeLimiter paces pokeClient's requests, kept here so the diagnostics command can report on it
+var pokeLimiter = pokeapi.NewRateLimiter(pokeapi.DefaultRequestsPerSecond, pokeapi.DefaultBurst)
+
+// Make pokeClient a package variable that can be modified for testing.
+// It is set in main, so tests never start a real client's background work.
+var pokeClient pokeapi.APIClient
+
+// commandExit says goodbye; the REPL loop stops after it, so main can close the client
+func commandExit(ctx context.Context, arg string) error {
 	fmt.Println("Closing the Pokedex... Goodbye!")
-	os.Stdout.Sync() // Flush stdout to ensure the message is displayed
-	os.Exit(0)
 	return nil
 }
 
-func commandHelp(arg string) error {
+func commandHelp(ctx context.Context, arg string) error {
 	fmt.Println("Welcome to the Pokedex!")
 	fmt.Println("Usage:")
 	fmt.Println("")
@@ -32,40 +47,80 @@ func commandHelp(arg string) error {
 	return nil
 }
 
-func commandMap(arg string) error {
-	locations, err := pokeClient.GetLocations(true)
+const mapUsage = "usage: map | map first | map last | map page <n>"
+
+func commandMap(ctx context.Context, arg string) error {
+	var locations *pokeapi.LocationResponse
+	var err error
+
+	fields := cleanInput(arg)
+	switch {
+	case len(fields) == 0:
+		locations, err = pokeClient.GetLocationsContext(ctx, true)
+	case len(fields) == 1 && fields[0] == "first":
+		locations, err = pokeClient.GetLocationPageContext(ctx, 1)
+	case len(fields) == 1 && fields[0] == "last":
+		var pages int
+		if pages, err = pokeClient.LocationPagesContext(ctx); err == nil {
+			locations, err = pokeClient.GetLocationPageContext(ctx, pages)
+		}
+	case len(fields) == 2 && fields[0] == "page":
+		page, convErr := strconv.Atoi(fields[1])
+		if convErr != nil {
+			return fmt.Errorf("invalid page number %q", fields[1])
+		}
+		locations, err = pokeClient.GetLocationPageContext(ctx, page)
+	default:
+		return errors.New(mapUsage)
+	}
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("Location areas:")
-	for _, loc := range locations.Results {
-		fmt.Printf("- %s\n", loc.Name)
-	}
-
+	printLocations(locations)
 	return nil
 }
 
-func commandMapb(arg string) error {
-	locations, err := pokeClient.GetLocations(false)
+func commandMapb(ctx context.Context, arg string) error {
+	locations, err := pokeClient.GetLocationsContext(ctx, false)
 	if err != nil {
 		return err
 	}
 
+	printLocations(locations)
+	return nil
+}
+
+func printLocations(locations *pokeapi.LocationResponse) {
 	fmt.Println("Location areas:")
 	for _, loc := range locations.Results {
 		fmt.Printf("- %s\n", loc.Name)
 	}
+}
+
+func commandPageSize(ctx context.Context, arg string) error {
+	if arg == "" {
+		fmt.Printf("Page size: %d\n", pokeClient.PageSize())
+		return nil
+	}
 
+	size, err := strconv.Atoi(arg)
+	if err != nil {
+		return fmt.Errorf("invalid page size %q", arg)
+	}
+	if err := pokeClient.SetPageSize(size); err != nil {
+		return err
+	}
+	fmt.Printf("Page size set to %d\n", size)
 	return nil
 }
 
-func commandExplore(arg string) error {
+func commandExplore(ctx context.Context, arg string) error {
 	if arg == "" {
 		return fmt.Errorf("missing location name")
 	}
 
-	pokeList, err := pokeClient.Explore(arg)
+	pokeList, err := pokeClient.ExploreContext(ctx, arg)
 	if err != nil {
 		return err
 	}
@@ -79,12 +134,12 @@ func commandExplore(arg string) error {
 	return nil
 }
 
-func commandCatch(arg string) error {
+func commandCatch(ctx context.Context, arg string) error {
 	if arg == "" {
 		return fmt.Errorf("missing Pokemon name")
 	}
 
-	caughtPokemon, err := pokeClient.Catch(arg)
+	caughtPokemon, err := pokeClient.CatchContext(ctx, arg)
 	if err != nil {
 		return err
 	}
@@ -99,12 +154,12 @@ func commandCatch(arg string) error {
 	return nil
 }
 
-func commandInspect(arg string) error {
+func commandInspect(ctx context.Context, arg string) error {
 	if arg == "" {
 		return fmt.Errorf("missing Pokemon name")
 	}
 
-	pokemon, err := pokeClient.InspectPokemon(arg)
+	pokemon, err := pokeClient.InspectPokemonContext(ctx, arg)
 	if err != nil {
 		return err
 	}
@@ -124,8 +179,8 @@ func commandInspect(arg string) error {
 	return nil
 }
 
-func commandPokedex(arg string) error {
-	pokedex, err := pokeClient.GetPokedex()
+func commandPokedex(ctx context.Context, arg string) error {
+	pokedex, err := pokeClient.GetPokedexContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -138,11 +193,105 @@ func commandPokedex(arg string) error {
 	return nil
 }
 
+const cacheUsage = "usage: cache stats | cache keys [prefix] | cache clear | cache export <file> | cache import <file>"
+
+func commandCache(ctx context.Context, arg string) error {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 {
+		return errors.New(cacheUsage)
+	}
+
+	switch fields[0] {
+	case "stats":
+		stats := pokeCache.Stats()
+		fmt.Println("Cache stats:")
+		fmt.Printf("  Entries in memory: %d\n", stats.Entries)
+		fmt.Printf("  Bytes in memory: %d (%d uncompressed, %.1fx compression)\n",
+			stats.Bytes, stats.RawBytes, stats.CompressionRatio())
+		fmt.Printf("  Hits: %d\n", stats.Hits)
+		fmt.Printf("  Stale hits: %d\n", stats.StaleHits)
+		fmt.Printf("  Misses: %d\n", stats.Misses)
+		fmt.Printf("  Evictions from memory: %d\n", stats.Evictions)
+		fmt.Printf("  Expirations (memory and store): %d\n", stats.Expirations)
+	case "keys":
+		var prefix string
+		if len(fields) > 1 {
+			prefix = fields[1]
+		}
+		keys := pokeCache.Keys(prefix)
+		fmt.Printf("Cached keys (%d):\n", len(keys))
+		for _, key := range keys {
+			fmt.Printf("- %s\n", key)
+		}
+	case "clear":
+		pokeCache.Clear()
+		fmt.Println("Cache cleared")
+	case "export":
+		if len(fields) != 2 {
+			return errors.New(cacheUsage)
+		}
+		return exportCache(fields[1])
+	case "import":
+		if len(fields) != 2 {
+			return errors.New(cacheUsage)
+		}
+		return importCache(fields[1])
+	default:
+		return errors.New(cacheUsage)
+	}
+
+	return nil
+}
+
+func exportCache(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", path, err)
+	}
+	if err := pokeCache.Snapshot(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	fmt.Printf("Cache exported to %s\n", path)
+	return nil
+}
+
+func importCache(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer file.Close()
+	if err := pokeCache.Restore(file); err != nil {
+		return err
+	}
+	fmt.Printf("Cache imported from %s\n", path)
+	return nil
+}
+
+func commandDiagnostics(ctx context.Context, arg string) error {
+	stats := pokeLimiter.Stats()
+	fmt.Println("Rate limiter:")
+	if stats.RequestsPerSecond <= 0 {
+		fmt.Println("  Limit: none")
+	} else {
+		fmt.Printf("  Limit: %.1f requests/s, bursts of %d\n", stats.RequestsPerSecond, stats.Burst)
+		fmt.Printf("  Available: %.1f\n", stats.Available)
+	}
+	fmt.Printf("  Requests: %d\n", stats.Requests)
+	fmt.Printf("  Throttled: %d (waited %s)\n", stats.Throttled, stats.Waited.Round(time.Millisecond))
+	return nil
+}
+
 type cliCommand struct {
 	name        string
 	description string
-	callback    func(arg string) error
+	callback    func(ctx context.Context, arg string) error
 	requiresArg bool
+	variadic    bool // receives every word after the command, case preserved, as one arg
 }
 
 func getCommands() map[string]cliCommand {
@@ -161,16 +310,24 @@ func getCommands() map[string]cliCommand {
 		},
 		"map": {
 			name:        "map",
-			description: "Display the next 20 locations",
+			description: "Display the next page of locations. Usage: map [first | last | page <n>]",
 			callback:    commandMap,
 			requiresArg: false,
+			variadic:    true,
 		},
 		"mapb": {
 			name:        "mapb",
-			description: "Display the previous 20 locations",
+			description: "Display the previous page of locations",
 			callback:    commandMapb,
 			requiresArg: false,
 		},
+		"pagesize": {
+			name:        "pagesize",
+			description: "Show or set how many locations map displays. Usage: pagesize [n]",
+			callback:    commandPageSize,
+			requiresArg: false,
+			variadic:    true,
+		},
 		"explore": {
 			name:        "explore",
 			description: "Explore a specific location. Usage: explore <location_name>",
@@ -195,5 +352,18 @@ func getCommands() map[string]cliCommand {
 			callback:    commandPokedex,
 			requiresArg: false,
 		},
+		"diagnostics": {
+			name:        "diagnostics",
+			description: "Show the state of the client's rate limiter",
+			callback:    commandDiagnostics,
+			requiresArg: false,
+		},
+		"cache": {
+			name:        "cache",
+			description: "Manage the response cache. Usage: cache stats | cache keys [prefix] | cache clear | cache export <file> | cache import <file>",
+			callback:    commandCache,
+			requiresArg: true,
+			variadic:    true,
+		},
 	}
 }
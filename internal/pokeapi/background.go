@@ -0,0 +1,46 @@
+package pokeapi
+
+import (
+	"context"
+	"sync"
+)
+
+// background tracks the goroutines a Client starts on its own, such as
+// revalidation, so Close can cancel them and wait before the cache is closed
+type background struct {
+	ctx    context.Context // cancelled by Close
+	cancel context.CancelFunc
+
+	mux    sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func (b *background) init() {
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+}
+
+// start runs fn in a tracked goroutine with the client's lifetime context.
+// Once the client is closing it returns false without running fn.
+func (b *background) start(fn func(ctx context.Context)) bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.closed {
+		return false
+	}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		fn(b.ctx)
+	}()
+	return true
+}
+
+// stop cancels background work and waits for it to finish
+func (b *background) stop() {
+	b.mux.Lock()
+	b.closed = true
+	b.cancel()
+	b.mux.Unlock()
+	b.wg.Wait()
+}
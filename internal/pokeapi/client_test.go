@@ -0,0 +1,844 @@
+package pokeapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Specter242/bootpokedex/internal/pokecache"
+)
+
+// newTestServer serves a fixed location-area list and counts the requests it receives
+func newTestServer(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		fmt.Fprint(w, `{"count":1,"results":[{"name":"canalave-city-area","url":"x"}]}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func TestExploreUsesCache(t *testing.T) {
+	server, hits := newTestServer(t)
+	client := NewClient(server.URL)
+	defer client.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.Explore("canalave-city-area"); err != nil {
+			t.Fatalf("Explore() error = %v", err)
+		}
+	}
+
+	if got := atomic.LoadInt32(hits); got != 1 {
+		t.Errorf("Expected 1 request to the server, got %d", got)
+	}
+	if stats := client.cache.Stats(); stats.Misses != 1 || stats.Hits != 2 {
+		t.Errorf("Expected 1 miss and 2 hits, got %+v", stats)
+	}
+}
+
+func TestCachedResultsAreCopies(t *testing.T) {
+	server, _ := newTestServer(t)
+	client := NewClient(server.URL)
+	defer client.Close()
+	session := client.NewSession()
+
+	for i := 0; i < 2; i++ {
+		page, err := session.GetLocationPage(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("GetLocationPage() error = %v", err)
+		}
+		page.Results[0].Name = "tampered"
+		page.Results = append(page.Results, Location{Name: "extra"})
+	}
+
+	page, err := session.GetLocationPage(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("GetLocationPage() error = %v", err)
+	}
+	if len(page.Results) != 1 || page.Results[0].Name != "canalave-city-area" {
+		t.Errorf("Expected changes to earlier results not to reach the cache, got %+v", page.Results)
+	}
+}
+
+func TestConcurrentFetchesAreCoalesced(t *testing.T) {
+	var hits int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		fmt.Fprint(w, `{"name":"canalave-city-area"}`)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	defer client.Close()
+
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Explore("canalave-city-area")
+			errs <- err
+		}()
+	}
+
+	// Give every caller time to join the in-flight request before it completes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Explore() error = %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Errorf("Expected 1 request to the server, got %d", got)
+	}
+}
+
+func TestServesStaleDataWhenUnavailable(t *testing.T) {
+	var down int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"name":"fresh"}`)
+	}))
+	defer server.Close()
+
+	clock := pokecache.NewFakeClock(time.Now())
+	client := NewClient(server.URL, WithCache(NewResponseCache(pokecache.WithClock(clock))), WithRetry(RetryPolicy{}))
+	defer client.Close()
+
+	staleURL := server.URL + "/location-area/stale-area"
+	client.cache.AddWithTTL(staleURL, []byte(`{"name":"stale"}`), time.Minute)
+	clock.Advance(2 * time.Minute)
+
+	pokeList, err := client.Explore("stale-area")
+	if err != nil {
+		t.Fatalf("Explore() error = %v", err)
+	}
+	if pokeList.Name != "stale" {
+		t.Errorf("Expected stale data, got %q", pokeList.Name)
+	}
+
+	if _, err := client.Explore("never-cached"); err == nil {
+		t.Error("Expected an error for an uncached area while unavailable")
+	}
+
+	// A successful fetch triggers revalidation of the stale entry in the background
+	atomic.StoreInt32(&down, 0)
+	if _, err := client.Explore("other-area"); err != nil {
+		t.Fatalf("Explore() error = %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if val, ok := client.cache.Get(staleURL); ok && string(val) == `{"name":"fresh"}` {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected stale entry to be revalidated")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRevalidatesWithETag(t *testing.T) {
+	var full, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inm := r.Header.Get("If-None-Match"); inm == `"v1"` || inm == `"v2"` {
+			atomic.AddInt32(&notModified, 1)
+			w.Header().Set("ETag", `"v2"`)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&full, 1)
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `{"name":"canalave-city-area"}`)
+	}))
+	defer server.Close()
+
+	clock := pokecache.NewFakeClock(time.Now())
+	client := NewClient(server.URL, WithCache(NewResponseCache(pokecache.WithClock(clock))))
+	defer client.Close()
+
+	url := server.URL + "/location-area/canalave-city-area"
+	if _, err := client.Explore("canalave-city-area"); err != nil {
+		t.Fatalf("Explore() error = %v", err)
+	}
+
+	// Expire the entry so the next call has to revalidate it
+	clock.Advance(locationAreaTTL + time.Minute)
+
+	pokeList, err := client.Explore("canalave-city-area")
+	if err != nil {
+		t.Fatalf("Explore() error = %v", err)
+	}
+	if pokeList.Name != "canalave-city-area" {
+		t.Errorf("Expected cached data after a 304, got %q", pokeList.Name)
+	}
+	if atomic.LoadInt32(&full) != 1 || atomic.LoadInt32(&notModified) != 1 {
+		t.Errorf("Expected 1 full and 1 conditional request, got %d and %d", full, notModified)
+	}
+	if _, ok := client.cache.Get(url); !ok {
+		t.Error("Expected a 304 to make the cached entry fresh again")
+	}
+	if validators, _ := client.cache.Validators(url); validators.ETag != `"v2"` {
+		t.Errorf("Expected the ETag from the 304 to replace the old one, got %q", validators.ETag)
+	}
+}
+
+func TestPrefetchesNextPageAndAreas(t *testing.T) {
+	var mux sync.Mutex
+	hits := make(map[string]int)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		hits[r.URL.String()]++
+		mux.Unlock()
+		switch r.URL.Path {
+		case "/location-area":
+			if r.URL.Query().Get("offset") == "" {
+				fmt.Fprintf(w, `{"next":"%s/location-area?offset=20","results":[{"name":"canalave-city-area"}]}`, server.URL)
+				return
+			}
+			fmt.Fprint(w, `{"results":[{"name":"eterna-city-area"}]}`)
+		default:
+			fmt.Fprint(w, `{"name":"area"}`)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, WithPrefetch(true))
+
+	if _, err := client.GetLocations(true); err != nil {
+		t.Fatalf("GetLocations() error = %v", err)
+	}
+	client.background.wg.Wait()
+
+	if _, err := client.GetLocations(true); err != nil {
+		t.Fatalf("GetLocations() error = %v", err)
+	}
+	if _, err := client.Explore("canalave-city-area"); err != nil {
+		t.Fatalf("Explore() error = %v", err)
+	}
+	client.Close()
+
+	mux.Lock()
+	defer mux.Unlock()
+	for _, path := range []string{"/location-area?offset=20", "/location-area/canalave-city-area"} {
+		if hits[path] != 1 {
+			t.Errorf("Expected %s to be fetched once, got %d", path, hits[path])
+		}
+	}
+}
+
+func TestCorruptCachedDataIsRefetched(t *testing.T) {
+	server, hits := newTestServer(t)
+	cache := NewResponseCache()
+	client := NewClient(server.URL, WithCache(cache))
+	defer client.Close()
+
+	cache.AddWithTTL(client.areaURL("canalave-city-area"), []byte(`{"count":`), time.Hour)
+
+	if _, err := client.Explore("canalave-city-area"); err != nil {
+		t.Fatalf("Explore() error = %v", err)
+	}
+	if got := atomic.LoadInt32(hits); got != 1 {
+		t.Errorf("Expected the corrupt entry to be refetched once, got %d requests", got)
+	}
+	if _, err := client.Explore("canalave-city-area"); err != nil {
+		t.Fatalf("Explore() after refetch error = %v", err)
+	}
+	if got := atomic.LoadInt32(hits); got != 1 {
+		t.Errorf("Expected the refetched entry to be cached, got %d requests", got)
+	}
+}
+
+func TestSessionsPageIndependently(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("offset") == "" {
+			fmt.Fprintf(w, `{"next":"%s/location-area?offset=20","results":[{"name":"canalave-city-area"}]}`, server.URL)
+			return
+		}
+		fmt.Fprintf(w, `{"previous":"%s/location-area","results":[{"name":"eterna-city-area"}]}`, server.URL)
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+	defer client.Close()
+
+	ash, misty := client.NewSession(), client.NewSession()
+	for i := 0; i < 2; i++ {
+		if _, err := ash.GetLocations(context.Background(), true); err != nil {
+			t.Fatalf("GetLocations() error = %v", err)
+		}
+	}
+	page, err := misty.GetLocations(context.Background(), true)
+	if err != nil {
+		t.Fatalf("GetLocations() error = %v", err)
+	}
+	if got := page.Results[0].Name; got != "canalave-city-area" {
+		t.Errorf("Expected a new session to start on the first page, got %s", got)
+	}
+	if got := ash.next; got != "" {
+		t.Errorf("Expected the first session to stay on the last page, got next %q", got)
+	}
+}
+
+func TestSessionJumpsToPages(t *testing.T) {
+	const count = 45
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, limit := 0, DefaultPageSize
+		fmt.Sscan(r.URL.Query().Get("offset"), &offset)
+		fmt.Sscan(r.URL.Query().Get("limit"), &limit)
+		next := ""
+		if offset+limit < count {
+			next = fmt.Sprintf("%s/location-area?offset=%d&limit=%d", server.URL, offset+limit, limit)
+		}
+		fmt.Fprintf(w, `{"count":%d,"next":%q,"results":[{"name":"area-%d"}]}`, count, next, offset)
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+	defer client.Close()
+	session := client.NewSession()
+
+	if pages, err := session.LocationPages(context.Background()); err != nil || pages != 3 {
+		t.Fatalf("LocationPages() = %d, %v; want 3", pages, err)
+	}
+	page, err := session.GetLocationPage(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("GetLocationPage(3) error = %v", err)
+	}
+	if got := page.Results[0].Name; got != "area-40" {
+		t.Errorf("Expected page 3 to start at area-40, got %s", got)
+	}
+	if _, err := session.GetLocationPage(context.Background(), 4); err == nil {
+		t.Error("Expected an error for a page past the end")
+	}
+
+	if err := session.SetPageSize(10); err != nil {
+		t.Fatalf("SetPageSize() error = %v", err)
+	}
+	if pages, _ := session.LocationPages(context.Background()); pages != 5 {
+		t.Errorf("Expected 5 pages of 10, got %d", pages)
+	}
+	page, err = session.GetLocations(context.Background(), true)
+	if err != nil {
+		t.Fatalf("GetLocations() error = %v", err)
+	}
+	if got := page.Results[0].Name; got != "area-40" {
+		t.Errorf("Expected a new page size to keep the position, got %s", got)
+	}
+	if got := page.Next; got != "" {
+		t.Errorf("Expected the page of 10 at offset 40 to be the last, got next %q", got)
+	}
+	if err := session.SetPageSize(0); err == nil {
+		t.Error("Expected an error for a page size of 0")
+	}
+}
+
+func TestContextCancelsRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := client.ExploreContext(ctx, "canalave-city-area")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected cancellation to return promptly, took %v", elapsed)
+	}
+}
+
+func TestCancelledWaiterDoesNotCancelSharedFetch(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, `{"name":"canalave-city-area"}`)
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+	defer client.Close()
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := client.Explore("canalave-city-area")
+		result <- err
+	}()
+
+	// Join the same fetch, then give up on it
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.ExploreContext(ctx, "canalave-city-area"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the cancelled caller to stop waiting, got %v", err)
+	}
+	close(release)
+
+	if err := <-result; err != nil {
+		t.Errorf("Expected the other caller to get the response, got %v", err)
+	}
+}
+
+// testRetryPolicy retries quickly so tests do not wait out real backoff
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 50 * time.Millisecond}
+
+func TestRetriesTransientFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int32
+		status     int
+		retryAfter string
+		wantErr    bool
+		wantHits   int32
+	}{
+		{"server error then success", 2, http.StatusServiceUnavailable, "", false, 3},
+		{"rate limited with Retry-After", 1, http.StatusTooManyRequests, "0", false, 2},
+		{"gives up after max attempts", 5, http.StatusBadGateway, "", true, 3},
+		{"Retry-After beyond max delay", 5, http.StatusTooManyRequests, "3600", true, 1},
+		{"client errors are not retried", 5, http.StatusNotFound, "", true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&hits, 1) <= tt.failures {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					http.Error(w, "try again", tt.status)
+					return
+				}
+				fmt.Fprint(w, `{"name":"canalave-city-area"}`)
+			}))
+			defer server.Close()
+			client := NewClient(server.URL, WithRetry(testRetryPolicy))
+			defer client.Close()
+
+			_, err := client.Explore("canalave-city-area")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Explore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(&hits); got != tt.wantHits {
+				t.Errorf("Expected %d requests, got %d", tt.wantHits, got)
+			}
+		})
+	}
+}
+
+func TestRetryWaits(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for n, max := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		delay, ok := policy.wait(n, nil)
+		if !ok || delay < max/2 || delay > max {
+			t.Errorf("wait(%d) = %v, %v; want between %v and %v", n, delay, ok, max/2, max)
+		}
+	}
+
+	unlimited := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second}
+	if delay, ok := unlimited.wait(4, nil); !ok || delay < 4*time.Second || delay > 8*time.Second {
+		t.Errorf("wait(4) with no MaxDelay = %v, %v; want between 4s and 8s", delay, ok)
+	}
+	if delay, ok := unlimited.wait(100, nil); !ok || delay <= 0 {
+		t.Errorf("wait(100) with no MaxDelay = %v, %v; want a positive delay", delay, ok)
+	}
+	limited := &http.Response{Header: http.Header{"Retry-After": []string{"30"}}}
+	if delay, ok := unlimited.wait(1, limited); !ok || delay != 30*time.Second {
+		t.Errorf("wait(1) with Retry-After and no MaxDelay = %v, %v; want 30s, true", delay, ok)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if delay, ok := retryAfter(now.Add(3*time.Second).Format(http.TimeFormat), now); !ok || delay != 3*time.Second {
+		t.Errorf("retryAfter(date) = %v, %v; want 3s", delay, ok)
+	}
+	if _, ok := retryAfter("soon", now); ok {
+		t.Error("Expected an unparseable Retry-After to be ignored")
+	}
+}
+
+func TestRateLimiterSpacesOutRequests(t *testing.T) {
+	server, hits := newTestServer(t)
+	limiter := NewRateLimiter(20, 2)
+	client := NewClient(server.URL, WithRateLimiter(limiter))
+	defer client.Close()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if _, err := client.Explore(fmt.Sprintf("area-%d", i)); err != nil {
+			t.Fatalf("Explore() error = %v", err)
+		}
+	}
+	// Two requests fit in the burst; the other two need 50ms worth of tokens each
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected requests beyond the burst to wait, took %v", elapsed)
+	}
+
+	stats := limiter.Stats()
+	if stats.Requests != int(atomic.LoadInt32(hits)) || stats.Throttled == 0 {
+		t.Errorf("Expected 4 requests with some throttled, got %+v", stats)
+	}
+}
+
+func TestRateLimiterWaitHonoursContext(t *testing.T) {
+	limiter := NewRateLimiter(1, 1)
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the wait to end with its context, got %v", err)
+	}
+	stats := limiter.Stats()
+	if stats.Available > 0.1 {
+		t.Errorf("Expected the bucket to still be empty, got %.2f tokens", stats.Available)
+	}
+	if stats.Waited > 500*time.Millisecond {
+		t.Errorf("Expected only the time actually waited to count, got %v", stats.Waited)
+	}
+}
+
+func TestThrottledRequestsAreNotUnavailable(t *testing.T) {
+	server, hits := newTestServer(t)
+	limiter := NewRateLimiter(0.01, 1)
+	// The http.Client's timeout replaces the transport's error, but must not hide the cause
+	client := NewClient(server.URL, WithRateLimiter(limiter), WithHTTPClient(&http.Client{Timeout: 10 * time.Millisecond}))
+	defer client.Close()
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	if _, err := client.Explore("area-1"); !errors.Is(err, ErrThrottled) || errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected a timed out wait to be ErrThrottled only, got %v", err)
+	}
+	if got := atomic.LoadInt32(hits); got != 0 {
+		t.Errorf("Expected no requests to reach the server, got %d", got)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pokemon/missingno":
+			http.Error(w, "Not Found", http.StatusNotFound)
+		case "/pokemon/busy":
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		default:
+			http.Error(w, "no", http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, WithRetry(RetryPolicy{}))
+	defer client.Close()
+
+	_, err := client.Catch("missingno")
+	var httpErr *HTTPError
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &httpErr) || httpErr.Status != http.StatusNotFound {
+		t.Errorf("Expected a 404 HTTPError matching ErrNotFound, got %v", err)
+	}
+	if errors.Is(err, ErrUnavailable) {
+		t.Error("Expected a 404 not to count as unavailable")
+	}
+
+	_, err = client.Catch("busy")
+	if !errors.Is(err, ErrRateLimited) || !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected a 429 to match ErrRateLimited and ErrUnavailable, got %v", err)
+	}
+
+	_, err = client.Explore("forbidden-area")
+	if !errors.As(err, &httpErr) || httpErr.Status != http.StatusForbidden || errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected a plain 403 HTTPError, got %v", err)
+	}
+
+	_, err = client.InspectPokemon("mew")
+	if !errors.Is(err, ErrNotCaught) || err.Error() != "you haven't caught mew yet" {
+		t.Errorf("Expected ErrNotCaught for an uncaught Pokemon, got %v", err)
+	}
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "no token", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"name":%q}`, r.Header.Get("X-Trace"))
+	}))
+	defer server.Close()
+
+	var order []string
+	header := func(key, value string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, key)
+				req = req.Clone(req.Context())
+				req.Header.Set(key, req.Header.Get(key)+value)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	var logs bytes.Buffer
+	client := NewClient(server.URL,
+		WithMiddleware(header("Authorization", "Bearer secret"), header("X-Trace", "outer")),
+		WithMiddleware(header("X-Trace", "-inner")),
+		WithRequestLogging(log.New(&logs, "", 0)),
+	)
+	defer client.Close()
+
+	pokeList, err := client.Explore("canalave-city-area")
+	if err != nil {
+		t.Fatalf("Explore() error = %v", err)
+	}
+	if pokeList.Name != "outer-inner" {
+		t.Errorf("Expected middlewares to run outermost first, got trace %q", pokeList.Name)
+	}
+	if fmt.Sprint(order) != "[Authorization X-Trace X-Trace]" {
+		t.Errorf("Expected each middleware to run once in order, got %v", order)
+	}
+	if !strings.Contains(logs.String(), "GET "+server.URL+"/location-area/canalave-city-area: 200 OK") {
+		t.Errorf("Expected the request to be logged, got %q", logs.String())
+	}
+}
+
+func TestBuiltInMiddlewaresCanBeTurnedOff(t *testing.T) {
+	server, hits := newTestServer(t)
+	client := NewClient(server.URL, WithCaching(false), WithRateLimiter(nil))
+	defer client.Close()
+
+	start := time.Now()
+	for i := 0; i < DefaultBurst+10; i++ {
+		if _, err := client.Explore("canalave-city-area"); err != nil {
+			t.Fatalf("Explore() error = %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(hits); got != DefaultBurst+10 {
+		t.Errorf("Expected every lookup to reach the server without caching, got %d requests", got)
+	}
+	// The default limiter would hold the last 10 requests for a second
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected no rate limiting, took %v", elapsed)
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	server, hits := newTestServer(t)
+	var sent int32
+	base := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&sent, 1)
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	httpClient := &http.Client{Transport: base}
+	client := NewClient(server.URL, WithHTTPClient(httpClient))
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Explore("canalave-city-area"); err != nil {
+			t.Fatalf("Explore() error = %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&sent); got != 1 || atomic.LoadInt32(hits) != 1 {
+		t.Errorf("Expected one request through the given transport and a cache hit, got %d", got)
+	}
+	if _, ok := httpClient.Transport.(RoundTripperFunc); !ok {
+		t.Error("Expected the caller's http.Client to be left unchanged")
+	}
+}
+
+func TestCacheMiddleware(t *testing.T) {
+	server, hits := newTestServer(t)
+	cache := pokecache.NewCache(time.Minute)
+	defer cache.Close()
+	httpClient := &http.Client{Transport: Chain(http.DefaultTransport, CacheMiddleware(cache, time.Minute))}
+
+	for i := 0; i < 2; i++ {
+		resp, err := httpClient.Get(server.URL + "/location-area/canalave-city-area")
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "canalave-city-area") {
+			t.Errorf("Expected the list every time, got %d %q", resp.StatusCode, body)
+		}
+		if fromCache := resp.Header.Get(fromCacheHeader) != ""; fromCache != (i == 1) {
+			t.Errorf("Request %d: expected from cache = %v", i+1, i == 1)
+		}
+	}
+	if got := atomic.LoadInt32(hits); got != 1 {
+		t.Errorf("Expected 1 request to the server, got %d", got)
+	}
+}
+
+func TestCacheMiddlewareRefetchesWhenCopyVanishes(t *testing.T) {
+	clock := pokecache.NewFakeClock(time.Now())
+	cache := pokecache.NewCache(time.Minute, pokecache.WithClock(clock), pokecache.WithStaleRetention(time.Hour))
+	defer cache.Close()
+	url := "http://pokeapi.test/location-area/canalave-city-area"
+	cache.AddWithValidators(url, []byte(`{"name":"old"}`), time.Minute, pokecache.Validators{ETag: `"v1"`})
+	clock.Advance(2 * time.Minute)
+
+	var conditional, plain int
+	base := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("If-None-Match") != "" {
+			conditional++
+			// The cached copy is cleared while the request is in flight
+			cache.Delete(url)
+			return &http.Response{StatusCode: http.StatusNotModified, Body: http.NoBody, Header: http.Header{}}, nil
+		}
+		plain++
+		return cachedResponse(req, []byte(`{"name":"new"}`)), nil
+	})
+	httpClient := &http.Client{Transport: Chain(base, CacheMiddleware(cache, time.Minute))}
+
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != `{"name":"new"}` {
+		t.Errorf("Expected the refetched body, got %d %q", resp.StatusCode, body)
+	}
+	if conditional != 1 || plain != 1 {
+		t.Errorf("Expected a conditional request and then a plain one, got %d and %d", conditional, plain)
+	}
+}
+
+type traceKey struct{}
+
+func TestMiddlewaresSeeCallerContextValues(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"name":%q}`, r.Header.Get("X-Trace"))
+	}))
+	defer server.Close()
+
+	trace := func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			if id, ok := req.Context().Value(traceKey{}).(string); ok {
+				req.Header.Set("X-Trace", id)
+			}
+			return next.RoundTrip(req)
+		})
+	}
+	client := NewClient(server.URL, WithMiddleware(trace))
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), traceKey{}, "trace-1"))
+	defer cancel()
+	pokeList, err := client.ExploreContext(ctx, "canalave-city-area")
+	if err != nil {
+		t.Fatalf("ExploreContext() error = %v", err)
+	}
+	if pokeList.Name != "trace-1" {
+		t.Errorf("Expected the middleware to see the caller's trace ID, got %q", pokeList.Name)
+	}
+}
+
+func TestCloseStopsRevalidation(t *testing.T) {
+	var down int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case atomic.LoadInt32(&down) == 1:
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+		case r.URL.Path == "/location-area/stale-area":
+			<-r.Context().Done() // revalidation hangs until cancelled
+		default:
+			fmt.Fprint(w, `{"name":"fresh"}`)
+		}
+	}))
+	defer server.Close()
+
+	clock := pokecache.NewFakeClock(time.Now())
+	client := NewClient(server.URL, WithCache(NewResponseCache(pokecache.WithClock(clock))), WithRetry(RetryPolicy{}))
+	client.cache.AddWithTTL(server.URL+"/location-area/stale-area", []byte(`{"name":"stale"}`), time.Minute)
+	clock.Advance(2 * time.Minute)
+	if _, err := client.Explore("stale-area"); err != nil {
+		t.Fatalf("Explore() error = %v", err)
+	}
+
+	// Coming back online starts revalidating the stale area in the background
+	atomic.StoreInt32(&down, 0)
+	if _, err := client.Explore("other-area"); err != nil {
+		t.Fatalf("Explore() error = %v", err)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		client.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected Close to cancel the background revalidation")
+	}
+	client.stale.mux.Lock()
+	defer client.stale.mux.Unlock()
+	if client.stale.running {
+		t.Error("Expected Close to wait for the revalidation to stop")
+	}
+}
+
+func TestPrefetchLeavesTokensForThePlayer(t *testing.T) {
+	var areaHits int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/location-area" {
+			atomic.AddInt32(&areaHits, 1)
+			fmt.Fprint(w, `{"name":"area"}`)
+			return
+		}
+		results := make([]string, 10)
+		for i := range results {
+			results[i] = fmt.Sprintf(`{"name":"area-%d"}`, i)
+		}
+		fmt.Fprintf(w, `{"next":"%s/location-area?offset=10","results":[%s]}`, server.URL, strings.Join(results, ","))
+	}))
+	defer server.Close()
+
+	// Practically no refill, so only the burst of 8 is available
+	limiter := NewRateLimiter(0.01, 8)
+	client := NewClient(server.URL, WithPrefetch(true), WithRateLimiter(limiter))
+	if _, err := client.GetLocations(true); err != nil {
+		t.Fatalf("GetLocations() error = %v", err)
+	}
+	client.background.wg.Wait()
+	client.Close()
+
+	if got := atomic.LoadInt32(&areaHits); got == 0 || got > 3 {
+		t.Errorf("Expected a few area prefetches, stopping at half the burst, got %d", got)
+	}
+	if got := limiter.Stats().Available; got < 4 {
+		t.Errorf("Expected half the burst left for the player, got %.1f tokens", got)
+	}
+}
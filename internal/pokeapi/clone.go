@@ -0,0 +1,39 @@
+package pokeapi
+
+// Cached responses are decoded once and shared by every cache hit, so the
+// client hands out deep copies. Callers can then sort or append to the
+// slices they get back without changing what later calls see.
+
+// cloneable is implemented by the response types fetchJSON can return
+type cloneable[T any] interface {
+	clone() T
+}
+
+func cloneSlice[E any](s []E) []E {
+	if s == nil {
+		return nil
+	}
+	out := make([]E, len(s))
+	copy(out, s)
+	return out
+}
+
+func (l LocationResponse) clone() LocationResponse {
+	l.Results = cloneSlice(l.Results)
+	return l
+}
+
+func (p PokeList) clone() PokeList {
+	encounters := cloneSlice(p.PokemonEncounters)
+	for i := range encounters {
+		encounters[i].Pokemon = encounters[i].Pokemon.clone()
+	}
+	p.PokemonEncounters = encounters
+	return p
+}
+
+func (p Pokemon) clone() Pokemon {
+	p.Stats = cloneSlice(p.Stats)
+	p.Types = cloneSlice(p.Types)
+	return p
+}
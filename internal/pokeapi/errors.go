@@ -0,0 +1,60 @@
+package pokeapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors returned by the client, for use with errors.Is
+var (
+	// ErrNotFound means PokeAPI has no such Pokemon or location area
+	ErrNotFound = errors.New("not found")
+	// ErrNotCaught means the Pokemon is not in the Pokedex
+	ErrNotCaught = errors.New("not caught")
+	// ErrRateLimited means PokeAPI kept answering 429 Too Many Requests, even after retries
+	ErrRateLimited = errors.New("rate limited by PokeAPI")
+	// ErrUnavailable means PokeAPI could not be reached, had a server error or
+	// kept rate limiting us, even after retries. Only these failures fall back
+	// to stale cache entries.
+	ErrUnavailable = errors.New("PokeAPI unavailable")
+	// ErrThrottled means a request gave up while queued for the client's own
+	// rate limiter, before anything was sent to PokeAPI
+	ErrThrottled = errors.New("gave up waiting for the rate limiter")
+)
+
+// HTTPError is returned when PokeAPI answers with a status other than 200 OK.
+// It matches ErrNotFound, ErrRateLimited and ErrUnavailable with errors.Is
+// according to its status.
+type HTTPError struct {
+	Status int
+	Body   string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s: %s", e.Status, http.StatusText(e.Status), e.Body)
+}
+
+// Is reports whether the status falls under target
+func (e *HTTPError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Status == http.StatusNotFound
+	case ErrRateLimited:
+		return e.Status == http.StatusTooManyRequests
+	case ErrUnavailable:
+		return e.Status == http.StatusTooManyRequests || e.Status >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// messageError gives a sentinel error a more specific message, while
+// still matching the sentinel with errors.Is
+type messageError struct {
+	err error
+	msg string
+}
+
+func (e *messageError) Error() string { return e.msg }
+
+func (e *messageError) Unwrap() error { return e.err }
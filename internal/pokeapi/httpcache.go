@@ -0,0 +1,133 @@
+package pokeapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Specter242/bootpokedex/internal/pokecache"
+)
+
+// fromCacheHeader marks responses that CacheMiddleware answered without contacting PokeAPI
+const fromCacheHeader = "X-From-Cache"
+
+// cacheEntryKey is the context key for the cacheEntry of a request
+type cacheEntryKey struct{}
+
+// cacheEntry tells CacheMiddleware where to keep a response and for how long.
+// The client only sends requests after missing in its typed caches, so
+// requests carrying one skip the middleware's own lookup of a fresh copy
+// and are not counted as a second miss.
+type cacheEntry struct {
+	key string // the URL exactly as the client's typed caches spell it
+	ttl time.Duration
+}
+
+// withCacheEntry asks CacheMiddleware to keep the response to requests made
+// with ctx under key for ttl
+func withCacheEntry(ctx context.Context, key string, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, cacheEntryKey{}, cacheEntry{key: key, ttl: ttl})
+}
+
+// WithCaching turns the client's response cache on or off. It is on by default;
+// with it off every lookup goes to PokeAPI and nothing is served stale.
+func WithCaching(enabled bool) Option {
+	return func(c *Client) {
+		c.caching = enabled
+	}
+}
+
+// CacheMiddleware answers GET requests from cache while the cached copy is fresh.
+// Stale copies are revalidated with If-None-Match and If-Modified-Since, and a
+// 304 Not Modified answer refreshes the cached copy and is turned back into
+// a 200 response with its body. Other 200 responses with a JSON body are
+// stored under their URL with their validators for ttl, unless the client
+// asked for a different key or TTL.
+func CacheMiddleware(cache *pokecache.Cache, ttl time.Duration) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method != http.MethodGet || req.Body != nil {
+				return next.RoundTrip(req)
+			}
+			key, ttl := req.URL.String(), ttl
+			entry, checked := req.Context().Value(cacheEntryKey{}).(cacheEntry)
+			if checked {
+				key, ttl = entry.key, entry.ttl
+			} else if body, found := cache.Get(key); found {
+				resp := cachedResponse(req, body)
+				resp.Header.Set(fromCacheHeader, "1")
+				return resp, nil
+			}
+
+			unconditional := req
+			validators, _ := cache.Validators(key)
+			if validators.ETag != "" || validators.LastModified != "" {
+				req = req.Clone(req.Context())
+				if validators.ETag != "" {
+					req.Header.Set("If-None-Match", validators.ETag)
+				}
+				if validators.LastModified != "" {
+					req.Header.Set("If-Modified-Since", validators.LastModified)
+				}
+			}
+
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				return nil, err
+			}
+
+			if resp.StatusCode == http.StatusNotModified && req != unconditional {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				if body, _, found := cache.GetStale(key); found {
+					// A 304 may carry newer validators; keep any it sends for the next
+					// request. The cached value itself is kept as it is.
+					cache.RefreshWithValidators(key, ttl, pokecache.Validators{
+						ETag:         resp.Header.Get("ETag"),
+						LastModified: resp.Header.Get("Last-Modified"),
+					})
+					return cachedResponse(req, body), nil
+				}
+				// The cached copy went away while the request was in flight, so ask again without validators
+				if resp, err = next.RoundTrip(unconditional); err != nil {
+					return nil, err
+				}
+			}
+			if resp.StatusCode != http.StatusOK {
+				return resp, nil
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			if json.Valid(body) {
+				cache.AddWithValidators(key, body, ttl, pokecache.Validators{
+					ETag:         resp.Header.Get("ETag"),
+					LastModified: resp.Header.Get("Last-Modified"),
+				})
+			}
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			return resp, nil
+		})
+	}
+}
+
+// cachedResponse builds a 200 OK response to req with a cached body
+func cachedResponse(req *http.Request, body []byte) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
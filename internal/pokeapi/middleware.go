@@ -0,0 +1,96 @@
+package pokeapi
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// Middleware wraps a RoundTripper with extra behaviour, such as adding
+// headers or tracing. Like any RoundTripper, it must not modify the request
+// it is given; clone it first to change headers.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function to an http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req)
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Chain wraps base in middlewares. The first middleware is the outermost,
+// so it sees each request first and each response last.
+func Chain(base http.RoundTripper, middlewares ...Middleware) http.RoundTripper {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		base = middlewares[i](base)
+	}
+	return base
+}
+
+// WithMiddleware adds middlewares to the client's transport, outside the
+// built-in caching, retry, rate limiting and logging ones. Repeated uses append.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(c *Client) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
+
+// WithRequestLogging logs every attempt the client sends, with its status and duration
+func WithRequestLogging(logger *log.Logger) Option {
+	return func(c *Client) {
+		c.requestLogger = logger
+	}
+}
+
+// LoggingMiddleware logs each request that passes through it
+func LoggingMiddleware(logger *log.Logger) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			elapsed := time.Since(start).Round(time.Millisecond)
+			if err != nil {
+				logger.Printf("%s %s: %v (%s)", req.Method, req.URL, err, elapsed)
+			} else {
+				logger.Printf("%s %s: %s (%s)", req.Method, req.URL, resp.Status, elapsed)
+			}
+			return resp, err
+		})
+	}
+}
+
+// WithHTTPClient sends requests with a copy of client. Its Transport, or
+// http.DefaultTransport if nil, becomes the base of the middleware chain and
+// its Timeout covers the whole chain. The client passed in is not modified.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		copied := *client
+		c.httpClient = &copied
+	}
+}
+
+// transport builds the client's middleware chain around base. From the
+// outside in: custom middlewares, caching, retries, rate limiting, then
+// logging, so cache hits skip the network and every retry waits for the
+// limiter and is logged. Each built-in layer can be switched off with its option.
+// The http.Client's Timeout covers the whole chain, retries included.
+func (c *Client) transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	middlewares := append([]Middleware(nil), c.middlewares...)
+	if c.caching {
+		middlewares = append(middlewares, CacheMiddleware(c.cache, cacheInterval))
+	}
+	if c.retry.MaxAttempts > 1 {
+		middlewares = append(middlewares, RetryMiddleware(c.retry))
+	}
+	if c.limiter != nil {
+		middlewares = append(middlewares, RateLimitMiddleware(c.limiter))
+	}
+	if c.requestLogger != nil {
+		middlewares = append(middlewares, LoggingMiddleware(c.requestLogger))
+	}
+	return Chain(base, middlewares...)
+}
@@ -1,46 +1,258 @@
 package pokeapi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"math/rand"
 	"net/http"
 	"time"
 
 	"github.com/Specter242/bootpokedex/internal/pokecache"
+	"github.com/Specter242/bootpokedex/internal/pokedex"
 )
 
 const cacheInterval = 30 * time.Second
 
-// APIClient interface defines the methods that need to be implemented
+// How long expired responses are kept to serve when PokeAPI is unreachable
+const staleRetention = 24 * time.Hour
+
+// Memory limits for the response cache, so crawling many pages stays bounded
+const (
+	cacheMaxBytes   = 16 << 20
+	cacheMaxEntries = 2000
+)
+
+// Responses at least this large are compressed in the cache
+const cacheCompressThreshold = 1 << 10
+
+// Cache lifetimes per endpoint. Location lists and areas rarely change,
+// so they are kept far longer than the reaper interval.
+const (
+	locationListTTL = 6 * time.Hour
+	locationAreaTTL = time.Hour
+	pokemonTTL      = 10 * time.Minute
+)
+
+// APIClient interface defines the methods that need to be implemented.
+// Each request method has a Context variant that stops when its ctx is cancelled.
 type APIClient interface {
 	GetLocations(directionFWD bool) (*LocationResponse, error)
+	GetLocationsContext(ctx context.Context, directionFWD bool) (*LocationResponse, error)
+	GetLocationPage(page int) (*LocationResponse, error)
+	GetLocationPageContext(ctx context.Context, page int) (*LocationResponse, error)
+	LocationPages() (int, error)
+	LocationPagesContext(ctx context.Context) (int, error)
+	PageSize() int
+	SetPageSize(size int) error
 	Explore(locationName string) (*PokeList, error)
+	ExploreContext(ctx context.Context, locationName string) (*PokeList, error)
 	Catch(pokemonName string) (bool, error)
+	CatchContext(ctx context.Context, pokemonName string) (bool, error)
 	InspectPokemon(pokemonName string) (*Pokemon, error)
+	InspectPokemonContext(ctx context.Context, pokemonName string) (*Pokemon, error)
 	GetPokedex() (*Pokedex, error)
+	GetPokedexContext(ctx context.Context) (*Pokedex, error)
 }
 
 // Client is a PokeAPI client that handles API requests.
 type Client struct {
 	BaseURL    string
-	HTTPClient *http.Client
+	httpClient *http.Client // its Transport is the middleware chain
 	cache      *pokecache.Cache
+	locations  *pokecache.TypedCache[LocationResponse]
+	areas      *pokecache.TypedCache[PokeList]
+	pokemon    *pokecache.TypedCache[Pokemon]
+	caught     *pokecache.TypedCache[Pokemon] // decoded copies of Pokedex entries
+	pokedex    *pokedex.Store
+	inflight   flightGroup
+	stale      staleSet
+	background background
+	logger     *log.Logger
+	session    *Session // used by the APIClient methods
+
+	// Transport middleware settings, applied in NewClient
+	caching       bool
+	retry         RetryPolicy
+	limiter       *RateLimiter // nil turns rate limiting off
+	requestLogger *log.Logger
+	middlewares   []Middleware
+
+	prefetchNext  bool
+	prefetchAreas bool
+}
+
+// Option configures optional Client behaviour in NewClient.
+type Option func(*Client)
+
+// WithPokedex makes the client record caught Pokemon in the given store.
+// Without it, caught Pokemon are only kept in memory.
+func WithPokedex(store *pokedex.Store) Option {
+	return func(c *Client) {
+		c.pokedex = store
+	}
 }
 
 // Ensure Client implements APIClient
 var _ APIClient = (*Client)(nil)
 
+// WithLogger sets where the client reports warnings, such as serving stale data.
+// By default warnings are discarded.
+func WithLogger(logger *log.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithCache makes the client use the given response cache instead of a private one.
+// The client takes ownership of the cache and closes it in Close.
+func WithCache(cache *pokecache.Cache) Option {
+	return func(c *Client) {
+		c.cache = cache
+	}
+}
+
+// WithCacheStore gives the client a response cache backed by store,
+// such as a directory shared with other tools
+func WithCacheStore(store pokecache.Store) Option {
+	return func(c *Client) {
+		c.cache = NewResponseCache(pokecache.WithStore(store))
+	}
+}
+
+// NewResponseCache creates a cache with the client's default expiry and memory limits.
+// Extra options, such as a disk tier, are applied on top.
+func NewResponseCache(opts ...pokecache.Option) *pokecache.Cache {
+	opts = append([]pokecache.Option{
+		pokecache.WithMaxBytes(cacheMaxBytes),
+		pokecache.WithMaxEntries(cacheMaxEntries),
+		pokecache.WithStaleRetention(staleRetention),
+		pokecache.WithCompression(cacheCompressThreshold),
+	}, opts...)
+	return pokecache.NewCache(cacheInterval, opts...)
+}
+
 // NewClient creates a new instance of the PokeAPI client.
-func NewClient(baseURL string) *Client {
-	return &Client{
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
 		BaseURL: baseURL,
-		HTTPClient: &http.Client{
+		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
-		cache: pokecache.NewCache(cacheInterval),
+		caching: true,
+		retry:   DefaultRetryPolicy,
+		limiter: NewRateLimiter(DefaultRequestsPerSecond, DefaultBurst),
+	}
+	c.background.init()
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.cache == nil {
+		c.cache = NewResponseCache()
+	}
+	c.cache.OnEvict(c.forgetStale)
+	c.locations = pokecache.NewTypedCache[LocationResponse](c.cache, pokecache.JSONCodec[LocationResponse]{})
+	c.areas = pokecache.NewTypedCache[PokeList](c.cache, pokecache.JSONCodec[PokeList]{})
+	c.pokemon = pokecache.NewTypedCache[Pokemon](c.cache, pokecache.JSONCodec[Pokemon]{})
+	c.caught = pokecache.NewTypedCache[Pokemon](pokecache.NewCache(cacheInterval), pokecache.JSONCodec[Pokemon]{})
+	if c.logger == nil {
+		c.logger = log.New(io.Discard, "", 0)
+	}
+	c.httpClient.Transport = c.transport(c.httpClient.Transport)
+	if c.pokedex == nil {
+		// An empty path never touches the disk, so this cannot fail
+		c.pokedex, _ = pokedex.NewStore("")
+	}
+	c.session = c.NewSession()
+	return c
+}
+
+// Close cancels background revalidation and prefetches, waits for them to
+// stop and releases the client's background resources, such as the cache reapers.
+func (c *Client) Close() {
+	c.background.stop()
+	c.cache.Close()
+	c.caught.Close()
+}
+
+// fetchJSON returns the decoded response for url, serving it from the typed cache when possible.
+// Fresh responses are cached for ttl. If PokeAPI is unavailable, a stale cached copy is used instead.
+// Cache hits are deep copies, so callers may modify what they get back.
+func fetchJSON[T cloneable[T]](ctx context.Context, c *Client, typed *pokecache.TypedCache[T], url string, ttl time.Duration) (*T, error) {
+	// A cached copy that cannot be decoded has already been dropped, so refetch it
+	if val, found, err := typed.Get(url); err != nil {
+		c.logger.Printf("discarding corrupt cached copy of %s: %v", url, err)
+	} else if found {
+		val = val.clone()
+		return &val, nil
+	}
+
+	body, err := c.inflight.do(ctx, url, func(ctx context.Context) ([]byte, error) {
+		return c.fetch(ctx, url, ttl)
+	})
+	if err != nil {
+		stale, ok := c.serveStale(url, ttl, err)
+		if !ok {
+			return nil, err
+		}
+		body = stale
+	}
+
+	// Decode through the typed cache, so the value is kept with the entry and a
+	// later 304 or stale fallback can reuse it instead of decoding again
+	if val, found, err := typed.Load(url); err == nil && found {
+		val = val.clone()
+		return &val, nil
+	}
+	var val T
+	if err := json.Unmarshal(body, &val); err != nil {
+		return nil, fmt.Errorf("error decoding response from %s: %w", url, err)
 	}
+	return &val, nil
+}
+
+// fetch downloads url, asking the cache middleware to keep the body for ttl.
+// Caching and conditional requests, retries and rate limiting all happen in
+// the transport's middleware chain.
+// Concurrent callers for the same url share one fetch through c.inflight.
+func (c *Client) fetch(ctx context.Context, url string, ttl time.Duration) ([]byte, error) {
+	throttled := false
+	ctx = context.WithValue(withCacheEntry(ctx, url, ttl), throttledKey{}, &throttled)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request for %s: %w", url, err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if throttled {
+			// Nothing reached PokeAPI, so it is not unavailable
+			return nil, fmt.Errorf("%w: error fetching %s: %w", ErrThrottled, url, err)
+		}
+		return nil, fmt.Errorf("%w: error fetching %s: %w", ErrUnavailable, url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error reading response from %s: %w", ErrUnavailable, url, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPError{Status: resp.StatusCode, Body: string(body)}
+	}
+
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("error decoding response from %s: invalid JSON", url)
+	}
+
+	if resp.Header.Get(fromCacheHeader) == "" {
+		// PokeAPI answered, so the network is back
+		c.revalidateStale()
+	}
+	return body, nil
 }
 
 type LocationResponse struct {
@@ -92,131 +304,71 @@ type Pokedex struct {
 	Pokemon []Pokemon `json:"pokemon"`
 }
 
-var (
-	CurrentLocationURL  string = "https://pokeapi.co/api/v2/location-area"
-	PreviousLocationURL string = ""
-	NextLocationURL     string = ""
-)
-
-// GetLocations fetches a list of locations.
+// GetLocations fetches a list of locations, paging the client's default session.
 func (c *Client) GetLocations(directionFWD bool) (*LocationResponse, error) {
-	var url string
-	if directionFWD {
-		url = NextLocationURL
-		if url == "" {
-			url = c.BaseURL + "/location-area"
-		}
-	} else {
-		url = PreviousLocationURL
-		if url == "" {
-			url = c.BaseURL + "/location-area"
-		}
-	}
-
-	// Try to get from cache first
-	if cachedData, exists := c.cache.Get(url); exists {
-		// fmt.Printf("Cache hit for URL: %s\n", url)
-		var locationResp LocationResponse
-		if err := json.Unmarshal(cachedData, &locationResp); err != nil {
-			return nil, fmt.Errorf("error decoding cached data: %w", err)
-		}
-		return &locationResp, nil
-	}
-
-	// fmt.Printf("Cache miss for URL: %s\n", url)
-	resp, err := c.HTTPClient.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching locations: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, body)
-	}
-
-	var locationResp LocationResponse
-	if err := json.NewDecoder(resp.Body).Decode(&locationResp); err != nil {
-		return nil, fmt.Errorf("error decoding location data: %w", err)
-	}
+	return c.GetLocationsContext(context.Background(), directionFWD)
+}
 
-	// Update URLs
-	CurrentLocationURL = url
-	NextLocationURL = locationResp.Next
-	PreviousLocationURL = locationResp.Previous
+// GetLocationsContext is GetLocations with a context that can cancel the request.
+func (c *Client) GetLocationsContext(ctx context.Context, directionFWD bool) (*LocationResponse, error) {
+	return c.session.GetLocations(ctx, directionFWD)
+}
 
-	// Serialize to JSON before storing in cache
-	jsonData, err := json.Marshal(&locationResp)
-	if err != nil {
-		return nil, fmt.Errorf("error serializing location data for cache: %w", err)
-	}
-	c.cache.Add(url, jsonData)
+// GetLocationPage fetches page n of the locations, counting from 1, in the default session.
+func (c *Client) GetLocationPage(page int) (*LocationResponse, error) {
+	return c.GetLocationPageContext(context.Background(), page)
+}
 
-	return &locationResp, nil
+// GetLocationPageContext is GetLocationPage with a context that can cancel the request.
+func (c *Client) GetLocationPageContext(ctx context.Context, page int) (*LocationResponse, error) {
+	return c.session.GetLocationPage(ctx, page)
 }
 
-func (c *Client) Explore(locationName string) (*PokeList, error) {
-	var url string
-	if locationName == "" {
-		url = CurrentLocationURL
-	} else {
-		url = c.BaseURL + "/location-area/" + locationName
-	}
+// LocationPages returns how many pages of locations the default session has.
+func (c *Client) LocationPages() (int, error) {
+	return c.LocationPagesContext(context.Background())
+}
 
-	// Try to get from cache first
-	if cachedData, exists := c.cache.Get(url); exists {
-		// fmt.Printf("Cache hit for URL: %s\n", url)
-		var pokeList PokeList
-		if err := json.Unmarshal(cachedData, &pokeList); err != nil {
-			return nil, fmt.Errorf("error decoding cached data: %w", err)
-		}
-		return &pokeList, nil
-	}
+// LocationPagesContext is LocationPages with a context that can cancel the request.
+func (c *Client) LocationPagesContext(ctx context.Context) (int, error) {
+	return c.session.LocationPages(ctx)
+}
 
-	// fmt.Printf("Cache miss for URL: %s\n", url)
-	resp, err := c.HTTPClient.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching locations: %w", err)
-	}
-	defer resp.Body.Close()
+// PageSize returns the default session's page size.
+func (c *Client) PageSize() int {
+	return c.session.PageSize()
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, body)
-	}
+// SetPageSize changes the default session's page size.
+func (c *Client) SetPageSize(size int) error {
+	return c.session.SetPageSize(size)
+}
 
-	var pokeList PokeList
-	if err := json.NewDecoder(resp.Body).Decode(&pokeList); err != nil {
-		return nil, fmt.Errorf("error decoding location data: %w", err)
-	}
+// areaURL is the URL for a location area's details, which is also its cache key
+func (c *Client) areaURL(name string) string {
+	return c.BaseURL + "/location-area/" + name
+}
 
-	// Serialize to JSON before storing in cache
-	jsonData, err := json.Marshal(&pokeList)
-	if err != nil {
-		return nil, fmt.Errorf("error serializing location data for cache: %w", err)
-	}
-	c.cache.Add(url, jsonData)
+func (c *Client) Explore(locationName string) (*PokeList, error) {
+	return c.ExploreContext(context.Background(), locationName)
+}
 
-	return &pokeList, nil
+// ExploreContext is Explore with a context that can cancel the request.
+func (c *Client) ExploreContext(ctx context.Context, locationName string) (*PokeList, error) {
+	return c.session.Explore(ctx, locationName)
 }
 
 func (c *Client) Catch(pokemonName string) (bool, error) {
+	return c.CatchContext(context.Background(), pokemonName)
+}
+
+// CatchContext is Catch with a context that can cancel the request.
+func (c *Client) CatchContext(ctx context.Context, pokemonName string) (bool, error) {
 	url := c.BaseURL + "/pokemon/" + pokemonName
 
-	resp, err := c.HTTPClient.Get(url)
+	pokemon, err := fetchJSON(ctx, c, c.pokemon, url, pokemonTTL)
 	if err != nil {
-		return false, fmt.Errorf("error fetching pokemon: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return false, fmt.Errorf("unexpected status %s: %s", resp.Status, body)
-	}
-
-	var pokemon Pokemon
-	if err := json.NewDecoder(resp.Body).Decode(&pokemon); err != nil {
-		return false, fmt.Errorf("error decoding pokemon data: %w", err)
+		return false, err
 	}
 
 	// Calculate catch chance
@@ -237,44 +389,65 @@ func (c *Client) Catch(pokemonName string) (bool, error) {
 	caught := roll < catchRate
 	if caught {
 		// Add to Pokedex
-		jsonData, err := json.Marshal(&pokemon)
+		jsonData, err := json.Marshal(pokemon)
 		if err != nil {
 			return false, fmt.Errorf("error serializing pokemon data: %w", err)
 		}
-		c.cache.Add("pokedex/"+pokemonName, jsonData)
+		if err := c.pokedex.Add(pokemonName, jsonData); err != nil {
+			return true, fmt.Errorf("error saving %s to the pokedex: %w", pokemonName, err)
+		}
+		c.caught.Delete(pokemonName)
 	}
 
 	return caught, nil
 }
 
 func (c *Client) InspectPokemon(pokemonName string) (*Pokemon, error) {
-	// Check if pokemon exists in pokedex (cache)
-	if cachedData, exists := c.cache.Get("pokedex/" + pokemonName); exists {
+	return c.InspectPokemonContext(context.Background(), pokemonName)
+}
+
+// InspectPokemonContext is InspectPokemon with a context. Caught Pokemon are
+// read from the Pokedex, so only an already cancelled ctx stops it.
+func (c *Client) InspectPokemonContext(ctx context.Context, pokemonName string) (*Pokemon, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Decoded Pokedex entries are kept pinned, so repeated lookups skip decoding
+	if pokemon, found, err := c.caught.Get(pokemonName); err == nil && found {
+		pokemon = pokemon.clone()
+		return &pokemon, nil
+	}
+
+	// Check if pokemon exists in pokedex
+	if cachedData, exists := c.pokedex.Get(pokemonName); exists {
 		var pokemon Pokemon
 		if err := json.Unmarshal(cachedData, &pokemon); err != nil {
 			return nil, fmt.Errorf("error decoding cached pokemon data: %w", err)
 		}
+		_ = c.caught.Add(pokemonName, pokemon.clone(), pokecache.NoExpiry)
 		return &pokemon, nil
 	}
 
-	return nil, fmt.Errorf("you haven't caught %s yet", pokemonName)
+	return nil, &messageError{ErrNotCaught, fmt.Sprintf("you haven't caught %s yet", pokemonName)}
 }
 
 func (c *Client) GetPokedex() (*Pokedex, error) {
-	var pokedex Pokedex
-	const prefix = "pokedex/"
+	return c.GetPokedexContext(context.Background())
+}
 
-	// Get all pokemon keys from cache
-	pokemonNames := c.cache.GetKeysWithPrefix(prefix)
+// GetPokedexContext is GetPokedex with a context that can cancel the listing.
+func (c *Client) GetPokedexContext(ctx context.Context) (*Pokedex, error) {
+	var dex Pokedex
 
-	for _, name := range pokemonNames {
-		if name == "" {
-			continue
+	for _, name := range c.pokedex.Names() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		if pokemon, err := c.InspectPokemon(name); err == nil {
-			pokedex.Pokemon = append(pokedex.Pokemon, *pokemon)
+		if pokemon, err := c.InspectPokemonContext(ctx, name); err == nil {
+			dex.Pokemon = append(dex.Pokemon, *pokemon)
 		}
 	}
 
-	return &pokedex, nil
+	return &dex, nil
 }
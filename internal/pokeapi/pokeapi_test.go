@@ -1,6 +1,7 @@
 package pokeapi
 
 import (
+	"context"
 	"testing"
 )
 
@@ -15,6 +16,22 @@ func (m *MockClient) GetLocations(directionFWD bool) (*LocationResponse, error)
 	return m.GetLocationsFunc(directionFWD)
 }
 
+func (m *MockClient) GetLocationPage(page int) (*LocationResponse, error) {
+	return nil, nil
+}
+
+func (m *MockClient) LocationPages() (int, error) {
+	return 1, nil
+}
+
+func (m *MockClient) PageSize() int {
+	return DefaultPageSize
+}
+
+func (m *MockClient) SetPageSize(size int) error {
+	return nil
+}
+
 func (m *MockClient) Explore(locationName string) (*PokeList, error) {
 	return m.ExploreFunc(locationName)
 }
@@ -31,6 +48,34 @@ func (m *MockClient) GetPokedex() (*Pokedex, error) {
 	return nil, nil
 }
 
+func (m *MockClient) GetLocationsContext(ctx context.Context, directionFWD bool) (*LocationResponse, error) {
+	return m.GetLocations(directionFWD)
+}
+
+func (m *MockClient) GetLocationPageContext(ctx context.Context, page int) (*LocationResponse, error) {
+	return m.GetLocationPage(page)
+}
+
+func (m *MockClient) LocationPagesContext(ctx context.Context) (int, error) {
+	return m.LocationPages()
+}
+
+func (m *MockClient) ExploreContext(ctx context.Context, locationName string) (*PokeList, error) {
+	return m.Explore(locationName)
+}
+
+func (m *MockClient) CatchContext(ctx context.Context, pokemonName string) (bool, error) {
+	return m.Catch(pokemonName)
+}
+
+func (m *MockClient) InspectPokemonContext(ctx context.Context, pokemonName string) (*Pokemon, error) {
+	return m.InspectPokemon(pokemonName)
+}
+
+func (m *MockClient) GetPokedexContext(ctx context.Context) (*Pokedex, error) {
+	return m.GetPokedex()
+}
+
 func TestClientImplementsInterface(t *testing.T) {
 	var _ APIClient = (*Client)(nil)
 	var _ APIClient = (*MockClient)(nil)
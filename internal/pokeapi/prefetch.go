@@ -0,0 +1,39 @@
+package pokeapi
+
+import "context"
+
+// WithPrefetch makes GetLocations fetch the next page into the cache in the
+// background, so the following map is instant. With areas set, the details of
+// every listed area are fetched too, so explore is instant as well.
+func WithPrefetch(areas bool) Option {
+	return func(c *Client) {
+		c.prefetchNext = true
+		c.prefetchAreas = areas
+	}
+}
+
+// prefetch warms the cache for what is likely to be requested after page.
+// Errors are ignored; a failed prefetch just means a normal fetch later.
+// Close cancels a prefetch in progress. Without caching there is nowhere
+// to keep the results, so nothing is prefetched.
+func (c *Client) prefetch(page *LocationResponse) {
+	if !c.prefetchNext || !c.caching {
+		return
+	}
+
+	c.background.start(func(ctx context.Context) {
+		if page.Next != "" {
+			_, _ = fetchJSON(ctx, c, c.locations, page.Next, locationListTTL)
+		}
+		if !c.prefetchAreas {
+			return
+		}
+		for _, loc := range page.Results {
+			// Leave half the burst for the player, so explore never queues behind prefetches
+			if ctx.Err() != nil || !c.limiter.spare() {
+				return
+			}
+			_, _ = fetchJSON(ctx, c, c.areas, c.areaURL(loc.Name), locationAreaTTL)
+		}
+	})
+}
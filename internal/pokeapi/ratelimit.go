@@ -0,0 +1,177 @@
+package pokeapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default client-side limits, which keep bulk features such as prefetching
+// well within PokeAPI's fair use policy
+const (
+	DefaultRequestsPerSecond = 10
+	DefaultBurst             = 20
+)
+
+// RateLimiter is a token bucket that spaces out requests to PokeAPI.
+// A Client waits on it before every attempt, including retries, so one
+// limiter bounds everything the client sends.
+type RateLimiter struct {
+	mux    sync.Mutex
+	rate   float64 // tokens added per second
+	burst  int
+	tokens float64 // negative while requests are queued for tokens
+	last   time.Time
+
+	requests  int
+	throttled int
+	waited    time.Duration
+}
+
+// RateLimiterStats is a snapshot of a RateLimiter's configuration and activity
+type RateLimiterStats struct {
+	RequestsPerSecond float64
+	Burst             int
+	Available         float64 // tokens that can be spent without waiting
+	Requests          int
+	Throttled         int           // requests that had to wait for a token
+	Waited            time.Duration // total time requests spent waiting
+}
+
+// NewRateLimiter allows requestsPerSecond on average, with bursts of up to burst
+// requests at once. A rate of 0 or less disables limiting.
+func NewRateLimiter(requestsPerSecond float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   requestsPerSecond,
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// WithRateLimit limits the client to requestsPerSecond with bursts of up to burst.
+// Clients are limited to DefaultRequestsPerSecond by default; a rate of 0 or
+// less turns limiting off.
+func WithRateLimit(requestsPerSecond float64, burst int) Option {
+	return WithRateLimiter(NewRateLimiter(requestsPerSecond, burst))
+}
+
+// WithRateLimiter makes the client wait on limiter, which may be shared with
+// other clients so they are limited together. Pass nil to turn limiting off.
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
+}
+
+// throttledKey is the context key for a *bool that RateLimitMiddleware sets
+// when a request gives up waiting. http.Client replaces the error when its
+// Timeout fires, so the flag is how fetch tells a throttled request apart.
+type throttledKey struct{}
+
+// RateLimitMiddleware makes every request wait its turn with limiter.
+// A request whose context ends while it waits fails with ErrThrottled.
+func RateLimitMiddleware(limiter *RateLimiter) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if err := limiter.Wait(req.Context()); err != nil {
+				if throttled, ok := req.Context().Value(throttledKey{}).(*bool); ok {
+					*throttled = true
+				}
+				return nil, fmt.Errorf("%w: %w", ErrThrottled, err)
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// refill adds the tokens earned since the last call. The caller must hold the lock.
+func (l *RateLimiter) refill(now time.Time) {
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+}
+
+// Wait blocks until a request may be sent or ctx ends
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mux.Lock()
+	l.requests++
+	if l.rate <= 0 {
+		l.mux.Unlock()
+		return nil
+	}
+	start := time.Now()
+	l.refill(start)
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+		l.throttled++
+		l.waited += delay
+	}
+	l.mux.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Hand the reserved token back for the requests queued behind us,
+		// and only count the time actually spent waiting
+		l.mux.Lock()
+		l.tokens++
+		if unused := delay - time.Since(start); unused > 0 {
+			l.waited -= unused
+		}
+		l.mux.Unlock()
+		return ctx.Err()
+	}
+}
+
+// spare reports whether a request could be sent now and still leave half
+// the burst available, so background work can give way to interactive requests. A nil limiter
+// always has tokens to spare.
+func (l *RateLimiter) spare() bool {
+	if l == nil {
+		return true
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.rate <= 0 {
+		return true
+	}
+	l.refill(time.Now())
+	return l.tokens-1 >= float64(l.burst)/2
+}
+
+// Stats returns the limiter's current state
+func (l *RateLimiter) Stats() RateLimiterStats {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.rate > 0 {
+		l.refill(time.Now())
+	}
+	available := l.tokens
+	if available < 0 {
+		available = 0
+	}
+	return RateLimiterStats{
+		RequestsPerSecond: l.rate,
+		Burst:             l.burst,
+		Available:         available,
+		Requests:          l.requests,
+		Throttled:         l.throttled,
+		Waited:            l.waited,
+	}
+}
@@ -0,0 +1,119 @@
+package pokeapi
+
+import (
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how the client retries requests that fail with a
+// network error, a server error or 429 Too Many Requests
+type RetryPolicy struct {
+	MaxAttempts int           // attempts per request, including the first; below 2 disables retries
+	BaseDelay   time.Duration // backoff before the first retry, doubled for each one after; zero retries at once
+	MaxDelay    time.Duration // longest wait between attempts, including Retry-After; zero means no limit
+}
+
+// DefaultRetryPolicy rides out brief outages without holding up the REPL for long
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   250 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+// WithRetry sets how failed requests are retried.
+// Pass RetryPolicy{} to turn retries off.
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// retryable reports whether an attempt that ended with resp and err is worth repeating
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// wait returns how long to wait before retry n, counting from 1. A Retry-After
+// header on resp is honoured; if it asks for longer than a non-zero MaxDelay, ok is false
+// and the request should not be retried.
+func (p RetryPolicy) wait(n int, resp *http.Response) (delay time.Duration, ok bool) {
+	if resp != nil {
+		if after, found := retryAfter(resp.Header.Get("Retry-After"), time.Now()); found {
+			return after, p.MaxDelay <= 0 || after <= p.MaxDelay
+		}
+	}
+
+	delay = p.BaseDelay << (n - 1)
+	if delay>>(n-1) != p.BaseDelay {
+		// The doubling overflowed
+		delay = math.MaxInt64
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	// Jitter keeps clients that failed together from retrying in lockstep
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1)), true
+}
+
+// retryAfter parses a Retry-After header, given either in seconds or as an HTTP date
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(header)
+	if err != nil {
+		return 0, false
+	}
+	if delay := date.Sub(now); delay > 0 {
+		return delay, true
+	}
+	return 0, true
+}
+
+// RetryMiddleware retries requests under policy. Requests with a body are
+// sent once, since the body cannot be replayed.
+func RetryMiddleware(policy RetryPolicy) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			for attempt := 1; ; attempt++ {
+				resp, err := next.RoundTrip(req)
+				if attempt >= policy.MaxAttempts || req.Body != nil || !retryable(ctx, resp, err) {
+					return resp, err
+				}
+				delay, ok := policy.wait(attempt, resp)
+				if !ok {
+					return resp, err
+				}
+				if resp != nil {
+					// Drain the body so the connection can be reused
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+
+				timer := time.NewTimer(delay)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return nil, ctx.Err()
+				case <-timer.C:
+				}
+			}
+		})
+	}
+}
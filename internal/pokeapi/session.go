@@ -0,0 +1,180 @@
+package pokeapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// DefaultPageSize is how many locations PokeAPI returns per page unless told otherwise
+const DefaultPageSize = 20
+
+// Session is one player's position in the paginated location list.
+// Sessions page independently, so several players can share one Client
+// and its cache without moving each other's cursor. Its methods take a
+// context that cancels the request.
+type Session struct {
+	client *Client
+
+	mux      sync.Mutex
+	current  string
+	next     string
+	previous string
+	pageSize int
+	count    int // total locations, as last reported by PokeAPI
+}
+
+// NewSession starts a session at the first page of locations
+func (c *Client) NewSession() *Session {
+	s := &Session{
+		client:   c,
+		pageSize: DefaultPageSize,
+	}
+	s.current = s.pageURL(0)
+	return s
+}
+
+// pageURL is the URL of the page starting at offset. The first page at the
+// default size is the bare endpoint, so it shares a cache entry with map.
+// The caller must hold the lock, or own s exclusively.
+func (s *Session) pageURL(offset int) string {
+	base := s.client.BaseURL + "/location-area"
+	if offset == 0 && s.pageSize == DefaultPageSize {
+		return base
+	}
+	return fmt.Sprintf("%s?offset=%d&limit=%d", base, offset, s.pageSize)
+}
+
+// pageOffset reads the offset query parameter of a page URL, which is 0 if absent
+func pageOffset(pageURL string) int {
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return 0
+	}
+	offset, _ := strconv.Atoi(parsed.Query().Get("offset"))
+	return offset
+}
+
+// GetLocations fetches the next or previous page of locations and moves the
+// session to it. Before the first page, either direction fetches the first page.
+func (s *Session) GetLocations(ctx context.Context, directionFWD bool) (*LocationResponse, error) {
+	s.mux.Lock()
+	url := s.previous
+	if directionFWD {
+		url = s.next
+	}
+	if url == "" {
+		url = s.pageURL(0)
+	}
+	s.mux.Unlock()
+
+	return s.visit(ctx, url)
+}
+
+// GetLocationPage fetches page n of the locations, counting from 1, and moves the session to it
+func (s *Session) GetLocationPage(ctx context.Context, page int) (*LocationResponse, error) {
+	if page < 1 {
+		return nil, errors.New("page must be at least 1")
+	}
+
+	s.mux.Lock()
+	url := s.pageURL((page - 1) * s.pageSize)
+	s.mux.Unlock()
+
+	pages, err := s.LocationPages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if page > pages {
+		return nil, fmt.Errorf("page %d is past the last page (%d)", page, pages)
+	}
+	return s.visit(ctx, url)
+}
+
+// LocationPages returns how many pages of locations there are at the current page size.
+// The total comes from the last page fetched, or from the first page if none has been.
+func (s *Session) LocationPages(ctx context.Context) (int, error) {
+	s.mux.Lock()
+	count, size, first := s.count, s.pageSize, s.pageURL(0)
+	s.mux.Unlock()
+
+	if count == 0 {
+		resp, err := fetchJSON(ctx, s.client, s.client.locations, first, locationListTTL)
+		if err != nil {
+			return 0, err
+		}
+		count = resp.Count
+		s.mux.Lock()
+		s.count = count
+		s.mux.Unlock()
+	}
+	if count == 0 {
+		return 1, nil
+	}
+	return (count + size - 1) / size, nil
+}
+
+// PageSize returns how many locations each page holds
+func (s *Session) PageSize() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.pageSize
+}
+
+// SetPageSize changes how many locations each page holds. The session stays
+// where it is: the next map starts from the first location of the current page.
+func (s *Session) SetPageSize(size int) error {
+	if size < 1 {
+		return errors.New("page size must be at least 1")
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	offset := pageOffset(s.current)
+	s.pageSize = size
+	s.current = s.pageURL(offset)
+	s.next = s.current
+	s.previous = ""
+	if offset > 0 {
+		prev := offset - size
+		if prev < 0 {
+			prev = 0
+		}
+		s.previous = s.pageURL(prev)
+	}
+	return nil
+}
+
+// visit fetches the page at url and makes it the session's current page
+func (s *Session) visit(ctx context.Context, url string) (*LocationResponse, error) {
+	locationResp, err := fetchJSON(ctx, s.client, s.client.locations, url, locationListTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mux.Lock()
+	s.current = url
+	s.next = locationResp.Next
+	s.previous = locationResp.Previous
+	s.count = locationResp.Count
+	s.mux.Unlock()
+
+	s.client.prefetch(locationResp)
+
+	return locationResp, nil
+}
+
+// Explore fetches the details of a location area. An empty name explores
+// the session's current page.
+func (s *Session) Explore(ctx context.Context, locationName string) (*PokeList, error) {
+	url := s.client.areaURL(locationName)
+	if locationName == "" {
+		s.mux.Lock()
+		url = s.current
+		s.mux.Unlock()
+	}
+	return fetchJSON(ctx, s.client, s.client.areas, url, locationAreaTTL)
+}
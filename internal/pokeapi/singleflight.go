@@ -0,0 +1,91 @@
+package pokeapi
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// flightCall is a fetch in progress that other callers can wait on
+type flightCall struct {
+	done    chan struct{}
+	val     []byte
+	err     error
+	cancel  context.CancelFunc
+	waiters int
+}
+
+// flightGroup coalesces concurrent fetches of the same key,
+// so only one request is in flight and every waiter shares its result
+type flightGroup struct {
+	mux   sync.Mutex
+	calls map[string]*flightCall
+}
+
+// do runs fn for key unless a call for key is already running,
+// in which case it waits for that call and returns its result.
+// A caller whose ctx ends stops waiting straight away, but the fetch itself
+// is only cancelled once every caller waiting on it has given up.
+// The fetch sees the values of the ctx that started it, such as tracing IDs.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) ([]byte, error)) ([]byte, error) {
+	g.mux.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	call, ok := g.calls[key]
+	if !ok {
+		callCtx, cancel := context.WithCancel(valuesOnly{ctx})
+		call = &flightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = call
+		go g.run(callCtx, key, call, fn)
+	}
+	call.waiters++
+	g.mux.Unlock()
+
+	select {
+	case <-call.done:
+		return call.val, call.err
+	case <-ctx.Done():
+		g.mux.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+			g.forget(key, call)
+		}
+		g.mux.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// run performs call and wakes its waiters
+func (g *flightGroup) run(ctx context.Context, key string, call *flightCall, fn func(context.Context) ([]byte, error)) {
+	call.val, call.err = fn(ctx)
+	call.cancel()
+	close(call.done)
+
+	g.mux.Lock()
+	g.forget(key, call)
+	g.mux.Unlock()
+}
+
+// forget removes call from the group if it is still the call for key,
+// so later callers start a new fetch. The caller must hold the lock.
+func (g *flightGroup) forget(key string, call *flightCall) {
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+}
+
+// valuesOnly is a context with its parent's values but not its deadline or
+// cancellation, so a shared fetch outlives the caller that started it
+type valuesOnly struct {
+	parent context.Context
+}
+
+func (valuesOnly) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (valuesOnly) Done() <-chan struct{} { return nil }
+
+func (valuesOnly) Err() error { return nil }
+
+func (v valuesOnly) Value(key any) any { return v.parent.Value(key) }
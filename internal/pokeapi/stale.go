@@ -0,0 +1,95 @@
+package pokeapi
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Specter242/bootpokedex/internal/pokecache"
+)
+
+// staleSet tracks URLs that were served stale and need refreshing once the network is back
+type staleSet struct {
+	mux     sync.Mutex
+	pending map[string]time.Duration // URL to the TTL it should be cached with
+	running bool
+}
+
+// serveStale returns the stale cached body for url after a failed fetch, if there is one,
+// and queues url for revalidation
+func (c *Client) serveStale(url string, ttl time.Duration, fetchErr error) ([]byte, bool) {
+	if !errors.Is(fetchErr, ErrUnavailable) {
+		return nil, false
+	}
+	body, _, found := c.cache.GetStale(url)
+	if !found {
+		return nil, false
+	}
+
+	c.logger.Printf("%v; using cached data for %s", fetchErr, url)
+
+	c.stale.mux.Lock()
+	defer c.stale.mux.Unlock()
+	if c.stale.pending == nil {
+		c.stale.pending = make(map[string]time.Duration)
+	}
+	c.stale.pending[url] = ttl
+	return body, true
+}
+
+// revalidateStale refreshes every URL that was served stale, in the background.
+// It is called after a successful fetch, since that means the network is back.
+func (c *Client) revalidateStale() {
+	c.stale.mux.Lock()
+	defer c.stale.mux.Unlock()
+	if c.stale.running || len(c.stale.pending) == 0 {
+		return
+	}
+	c.stale.running = c.background.start(c.revalidateLoop)
+}
+
+// revalidateLoop refetches pending URLs until none are left, the network
+// fails again or ctx is cancelled by Close
+func (c *Client) revalidateLoop(ctx context.Context) {
+	for {
+		c.stale.mux.Lock()
+		var (
+			url string
+			ttl time.Duration
+		)
+		for url, ttl = range c.stale.pending {
+			break
+		}
+		if url == "" {
+			c.stale.running = false
+			c.stale.mux.Unlock()
+			return
+		}
+		delete(c.stale.pending, url)
+		c.stale.mux.Unlock()
+
+		_, err := c.inflight.do(ctx, url, func(ctx context.Context) ([]byte, error) {
+			return c.fetch(ctx, url, ttl)
+		})
+		if err != nil {
+			// Still offline or closing; keep it queued for the next successful fetch
+			c.stale.mux.Lock()
+			c.stale.pending[url] = ttl
+			c.stale.running = false
+			c.stale.mux.Unlock()
+			return
+		}
+	}
+}
+
+// forgetStale drops the pending revalidation for a key that was deleted or cleared
+// from the cache, so clearing the cache does not trigger background refetches
+func (c *Client) forgetStale(key string, _ []byte, reason pokecache.EvictReason) {
+	if reason != pokecache.EvictDeleted && reason != pokecache.EvictCleared {
+		return
+	}
+	c.stale.mux.Lock()
+	defer c.stale.mux.Unlock()
+	delete(c.stale.pending, key)
+}
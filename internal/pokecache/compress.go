@@ -0,0 +1,65 @@
+package pokecache
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+)
+
+// WithCompression compresses values of at least threshold bytes with DEFLATE.
+// Values are decompressed on the way out, so callers never see the difference.
+// Compression is skipped for values it would not make smaller.
+func WithCompression(threshold int) Option {
+	return func(c *Cache) {
+		c.compressAt = threshold
+	}
+}
+
+// compress returns a compressed copy of entry, or entry itself if compression
+// is off, the value is below the threshold, or compression does not help
+func (c *Cache) compress(entry *Entry) *Entry {
+	if c.compressAt <= 0 || entry.Compressed || len(entry.Value) < c.compressAt {
+		return entry
+	}
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return entry
+	}
+	if _, err := w.Write(entry.Value); err != nil {
+		return entry
+	}
+	if err := w.Close(); err != nil || buf.Len() >= len(entry.Value) {
+		return entry
+	}
+
+	compressed := *entry
+	compressed.Value = buf.Bytes()
+	compressed.Compressed = true
+	compressed.RawSize = len(entry.Value)
+	return &compressed
+}
+
+// plain returns the entry's value, decompressing it if needed
+func (e *Entry) plain() ([]byte, error) {
+	if !e.Compressed {
+		return e.Value, nil
+	}
+	r := flate.NewReader(bytes.NewReader(e.Value))
+	defer r.Close()
+	val, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing cache entry %s: %w", e.Key, err)
+	}
+	return val, nil
+}
+
+// rawSize is the entry's size before compression, counted like size
+func (e *Entry) rawSize() int {
+	if e.Compressed {
+		return len(e.Key) + e.RawSize
+	}
+	return e.size()
+}
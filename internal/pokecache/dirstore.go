@@ -0,0 +1,232 @@
+package pokecache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultDiskDir returns the directory for on-disk cache entries,
+// which is $XDG_CACHE_HOME/pokedex on Linux
+func DefaultDiskDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("error locating cache directory: %w", err)
+	}
+	return filepath.Join(dir, "pokedex"), nil
+}
+
+// pinnedExpiry is the expiry time recorded for entries that never expire
+var pinnedExpiry = time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// DirStore is a Store that keeps one JSON file per entry in a directory,
+// named by a hash of the key. Writes are atomic renames, so several
+// processes can safely share one directory. Files that fail their checksum
+// are moved to a quarantine subdirectory and treated as missing.
+// Each file's modification time is set to when its entry expires, so
+// expired files can be found without reading every one.
+type DirStore struct {
+	dir string
+}
+
+var _ Store = (*DirStore)(nil)
+
+// NewDirStore creates a DirStore in dir. The directory is created on first write.
+func NewDirStore(dir string) *DirStore {
+	return &DirStore{dir: dir}
+}
+
+func (d *DirStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:]))
+}
+
+// Get reads the entry for key. Missing and corrupt files are treated as missing.
+func (d *DirStore) Get(key string) (Entry, bool) {
+	entry, err := d.read(d.path(key))
+	if err != nil {
+		return Entry{}, false
+	}
+	if entry.Key != key {
+		d.quarantine(d.path(key))
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// read loads the entry in path, quarantining the file if it is corrupt
+func (d *DirStore) read(path string) (Entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	entry, err := decodeRecord(data)
+	if err != nil {
+		d.quarantine(path)
+		return Entry{}, err
+	}
+	return entry, nil
+}
+
+// quarantine moves a bad entry file aside, so it is refetched but can still be inspected
+func (d *DirStore) quarantine(path string) {
+	dir := filepath.Join(d.dir, "quarantine")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		os.Remove(path)
+		return
+	}
+	if err := os.Rename(path, filepath.Join(dir, filepath.Base(path))); err != nil {
+		os.Remove(path)
+	}
+}
+
+// Add writes the entry to a temporary file and renames it into place,
+// so readers never see a partially written entry
+func (d *DirStore) Add(entry Entry) error {
+	data, err := encodeRecord(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		return fmt.Errorf("error creating cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(d.dir, ".entry-*")
+	if err != nil {
+		return fmt.Errorf("error creating cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing cache file: %w", err)
+	}
+	// Best effort; DeleteExpired checks the entry itself when the time looks expired
+	expiry := expiryTime(entry)
+	_ = os.Chtimes(tmp.Name(), expiry, expiry)
+	return os.Rename(tmp.Name(), d.path(entry.Key))
+}
+
+// expiryTime is when entry expires, or pinnedExpiry if it never does
+func expiryTime(entry Entry) time.Time {
+	if entry.TTL == NoExpiry {
+		return pinnedExpiry
+	}
+	return entry.CreatedAt.Add(entry.TTL)
+}
+
+// Delete removes the file for key
+func (d *DirStore) Delete(key string) error {
+	err := os.Remove(d.path(key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error deleting cache file: %w", err)
+	}
+	return nil
+}
+
+// Keys reads every entry file and returns the keys they hold
+func (d *DirStore) Keys() ([]string, error) {
+	var keys []string
+	err := d.walk(func(path string, entry Entry) {
+		keys = append(keys, entry.Key)
+	})
+	return keys, err
+}
+
+// DeleteExpired removes entry files that had expired at cutoff. Only files
+// whose modification time has passed are read, to confirm the expiry.
+func (d *DirStore) DeleteExpired(cutoff time.Time) ([]string, error) {
+	files, err := d.entryFiles()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		entry, err := d.read(path)
+		if err != nil {
+			continue
+		}
+		if !entry.Expired(cutoff) {
+			// Written by an older build or rounded by the file system; record the real expiry
+			expiry := expiryTime(entry)
+			_ = os.Chtimes(path, expiry, expiry)
+			continue
+		}
+		if os.Remove(path) == nil {
+			removed = append(removed, entry.Key)
+		}
+	}
+	return removed, nil
+}
+
+// Clear removes every entry file. Anything else in the directory is left alone.
+func (d *DirStore) Clear() error {
+	files, err := d.entryFiles()
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		os.Remove(path)
+	}
+	return nil
+}
+
+// Close does nothing; a DirStore keeps no files open
+func (d *DirStore) Close() error {
+	return nil
+}
+
+// walk calls fn for every readable entry file in the directory
+func (d *DirStore) walk(fn func(path string, entry Entry)) error {
+	files, err := d.entryFiles()
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		entry, err := d.read(path)
+		if err != nil {
+			continue
+		}
+		fn(path, entry)
+	}
+	return nil
+}
+
+// entryFiles lists the paths of files that look like they were written by a DirStore
+func (d *DirStore) entryFiles() ([]string, error) {
+	files, err := os.ReadDir(d.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading cache directory: %w", err)
+	}
+
+	var paths []string
+	for _, file := range files {
+		if isEntryFile(file.Name()) {
+			paths = append(paths, filepath.Join(d.dir, file.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// isEntryFile reports whether name looks like a file written by a DirStore
+func isEntryFile(name string) bool {
+	if len(name) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
@@ -0,0 +1,74 @@
+package pokecache
+
+// EvictReason says why an entry left the cache
+type EvictReason int
+
+const (
+	// EvictExpired means the entry outlived its TTL and any stale retention
+	EvictExpired EvictReason = iota
+	// EvictLRU means the entry was dropped to keep the cache within its limits
+	EvictLRU
+	// EvictDeleted means the entry was removed with Delete
+	EvictDeleted
+	// EvictCleared means the entry was removed with Clear
+	EvictCleared
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictExpired:
+		return "expired"
+	case EvictLRU:
+		return "lru"
+	case EvictDeleted:
+		return "deleted"
+	case EvictCleared:
+		return "cleared"
+	default:
+		return "unknown"
+	}
+}
+
+// EvictFunc is called with the key and value of an entry that left the cache
+type EvictFunc func(key string, val []byte, reason EvictReason)
+
+// eviction is an entry removed while the lock was held, waiting to be reported
+type eviction struct {
+	entry  *Entry
+	reason EvictReason
+}
+
+// OnEvict registers fn to be called whenever an entry leaves the in-memory tier.
+// Callbacks run after the cache's lock is released, so they may use the cache.
+func (c *Cache) OnEvict(fn EvictFunc) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.listeners = append(c.listeners, fn)
+}
+
+// recordEviction queues entry to be reported to OnEvict callbacks.
+// The caller must hold the write lock.
+func (c *Cache) recordEviction(entry *Entry, reason EvictReason) {
+	if len(c.listeners) == 0 {
+		return
+	}
+	c.evicted = append(c.evicted, eviction{entry: entry, reason: reason})
+}
+
+// unlockAndNotify releases the write lock, then reports entries evicted while it was held
+func (c *Cache) unlockAndNotify() {
+	evicted := c.evicted
+	c.evicted = nil
+	listeners := c.listeners
+	c.mux.Unlock()
+
+	for _, ev := range evicted {
+		val, err := ev.entry.plain()
+		if err != nil {
+			continue
+		}
+		for _, fn := range listeners {
+			fn(ev.entry.Key, val, ev.reason)
+		}
+	}
+}
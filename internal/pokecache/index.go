@@ -0,0 +1,47 @@
+package pokecache
+
+import (
+	"sort"
+	"strings"
+)
+
+// keyIndex keeps keys in sorted order, so prefix queries cost O(log n) plus
+// the number of matches, and listings always come out in the same order
+type keyIndex struct {
+	keys []string
+}
+
+// insert adds key if it is not already present
+func (x *keyIndex) insert(key string) {
+	i := sort.SearchStrings(x.keys, key)
+	if i < len(x.keys) && x.keys[i] == key {
+		return
+	}
+	x.keys = append(x.keys, "")
+	copy(x.keys[i+1:], x.keys[i:])
+	x.keys[i] = key
+}
+
+// remove deletes key if it is present
+func (x *keyIndex) remove(key string) {
+	i := sort.SearchStrings(x.keys, key)
+	if i < len(x.keys) && x.keys[i] == key {
+		x.keys = append(x.keys[:i], x.keys[i+1:]...)
+	}
+}
+
+// withPrefix returns the keys that start with prefix, in sorted order
+func (x *keyIndex) withPrefix(prefix string) []string {
+	start := sort.SearchStrings(x.keys, prefix)
+	end := start
+	for end < len(x.keys) && strings.HasPrefix(x.keys[end], prefix) {
+		end++
+	}
+	matches := make([]string, end-start)
+	copy(matches, x.keys[start:end])
+	return matches
+}
+
+func (x *keyIndex) reset() {
+	x.keys = nil
+}
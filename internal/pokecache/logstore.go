@@ -0,0 +1,347 @@
+package pokecache
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// logOp is the kind of change a log record describes
+type logOp string
+
+const (
+	logAdd    logOp = "add"
+	logDelete logOp = "delete"
+)
+
+// logCompactSize is how many bytes of superseded records a LogStore tolerates
+// before compacting itself, as long as they also outweigh the live records
+const logCompactSize = 1 << 20
+
+// logRecord is one line of a LogStore file. Add records carry the entry
+// as a checksummed record, so damage to one line only loses that entry.
+type logRecord struct {
+	Op     logOp           `json:"op"`
+	Key    string          `json:"key"`
+	Record json.RawMessage `json:"record,omitempty"`
+}
+
+// logPos locates the latest add record for a key, along with enough of
+// the entry to expire it without reading the record back
+type logPos struct {
+	offset    int64
+	length    int
+	createdAt time.Time
+	ttl       time.Duration
+}
+
+// LogStore is a Store that appends every change to a single log file and
+// keeps an index of where each live entry is. Reopening the file replays
+// the log. Superseded records are dropped by compacting the log, which
+// happens on its own once they outweigh the live ones. Corrupt add records
+// are copied to a ".quarantine" file next to the log and treated as missing.
+//
+// A LogStore is for a single process. It does not lock the file or see
+// records appended by others, and Compact replaces the file outright, so
+// two processes sharing one log lose each other's writes. Use a DirStore
+// to share a cache between processes.
+type LogStore struct {
+	mux   sync.Mutex
+	path  string
+	file  *os.File
+	size  int64
+	live  int64 // bytes of the records the index points at
+	index map[string]logPos
+
+	compactAt int64 // superseded bytes that trigger compaction
+}
+
+var _ Store = (*LogStore)(nil)
+
+// OpenLogStore opens or creates the log at path and replays it to rebuild the index.
+// A partially written record at the end of the file, left by a crash, is discarded.
+func OpenLogStore(path string) (*LogStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating cache directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening cache log: %w", err)
+	}
+
+	s := &LogStore{
+		path:      path,
+		file:      file,
+		index:     make(map[string]logPos),
+		compactAt: logCompactSize,
+	}
+	if err := s.replay(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.maybeCompact()
+	return s, nil
+}
+
+// replay rebuilds the index from the log and truncates any incomplete trailing record
+func (s *LogStore) replay() error {
+	reader := bufio.NewReader(s.file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading cache log: %w", err)
+		}
+
+		var record logRecord
+		if json.Unmarshal(line, &record) == nil {
+			s.replayRecord(record, line, offset)
+		}
+		offset += int64(len(line))
+	}
+
+	if err := s.file.Truncate(offset); err != nil {
+		return fmt.Errorf("error repairing cache log: %w", err)
+	}
+	s.size = offset
+	return nil
+}
+
+// replayRecord indexes a record read back from the log at offset.
+// A corrupt add hides any earlier entry for its key rather than resurrecting it.
+func (s *LogStore) replayRecord(record logRecord, line []byte, offset int64) {
+	if record.Op != logAdd {
+		s.apply(record.Op, record.Key, nil, offset, len(line))
+		return
+	}
+	entry, err := decodeRecord(record.Record)
+	if err != nil || entry.Key != record.Key {
+		s.quarantine(line)
+		s.apply(logDelete, record.Key, nil, offset, len(line))
+		return
+	}
+	s.apply(logAdd, record.Key, &entry, offset, len(line))
+}
+
+// apply updates the index for a record written at offset
+func (s *LogStore) apply(op logOp, key string, entry *Entry, offset int64, length int) {
+	if old, exists := s.index[key]; exists {
+		s.live -= int64(old.length)
+	}
+	switch op {
+	case logAdd:
+		s.live += int64(length)
+		s.index[key] = logPos{
+			offset:    offset,
+			length:    length,
+			createdAt: entry.CreatedAt,
+			ttl:       entry.TTL,
+		}
+	case logDelete:
+		delete(s.index, key)
+	}
+}
+
+// quarantine keeps a copy of a corrupt line for inspection. It is best effort.
+func (s *LogStore) quarantine(line []byte) {
+	file, err := os.OpenFile(s.path+".quarantine", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return
+	}
+	file.Write(line)
+	file.Close()
+}
+
+// append writes a record to the end of the log and indexes it.
+// The caller must hold the lock.
+func (s *LogStore) append(record logRecord, entry *Entry) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error serializing cache record: %w", err)
+	}
+	data = append(data, '\n')
+
+	if _, err := s.file.WriteAt(data, s.size); err != nil {
+		return fmt.Errorf("error writing cache log: %w", err)
+	}
+	s.apply(record.Op, record.Key, entry, s.size, len(data))
+	s.size += int64(len(data))
+	return nil
+}
+
+// Get reads the latest entry for key from the log
+func (s *LogStore) Get(key string) (Entry, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	pos, exists := s.index[key]
+	if !exists {
+		return Entry{}, false
+	}
+	line := make([]byte, pos.length)
+	if _, err := s.file.ReadAt(line, pos.offset); err != nil {
+		return Entry{}, false
+	}
+	var record logRecord
+	err := json.Unmarshal(line, &record)
+	var entry Entry
+	if err == nil {
+		entry, err = decodeRecord(record.Record)
+	}
+	if err != nil || entry.Key != key {
+		s.quarantine(line)
+		s.append(logRecord{Op: logDelete, Key: key}, nil)
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// Add appends entry to the log
+func (s *LogStore) Add(entry Entry) error {
+	data, err := encodeRecord(entry)
+	if err != nil {
+		return err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if err := s.append(logRecord{Op: logAdd, Key: entry.Key, Record: data}, &entry); err != nil {
+		return err
+	}
+	s.maybeCompact()
+	return nil
+}
+
+// Delete appends a deletion record for key, if it is present
+func (s *LogStore) Delete(key string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, exists := s.index[key]; !exists {
+		return nil
+	}
+	if err := s.append(logRecord{Op: logDelete, Key: key}, nil); err != nil {
+		return err
+	}
+	s.maybeCompact()
+	return nil
+}
+
+// Keys returns every live key in the log
+func (s *LogStore) Keys() ([]string, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	keys := make([]string, 0, len(s.index))
+	for key := range s.index {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// DeleteExpired appends deletion records for entries that had expired at cutoff
+func (s *LogStore) DeleteExpired(cutoff time.Time) ([]string, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var removed []string
+	for key, pos := range s.index {
+		entry := Entry{CreatedAt: pos.createdAt, TTL: pos.ttl}
+		if !entry.Expired(cutoff) {
+			continue
+		}
+		if err := s.append(logRecord{Op: logDelete, Key: key}, nil); err != nil {
+			return removed, err
+		}
+		removed = append(removed, key)
+	}
+	s.maybeCompact()
+	return removed, nil
+}
+
+// Clear empties the log
+func (s *LogStore) Clear() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if err := s.file.Truncate(0); err != nil {
+		return fmt.Errorf("error clearing cache log: %w", err)
+	}
+	s.size = 0
+	s.live = 0
+	s.index = make(map[string]logPos)
+	return nil
+}
+
+// maybeCompact compacts the log once superseded records pass compactAt bytes
+// and outweigh the live ones. It is best effort; a failure leaves the log as
+// it was, to be tried again after the next change. The caller must hold the lock.
+func (s *LogStore) maybeCompact() {
+	superseded := s.size - s.live
+	if superseded > s.compactAt && superseded > s.live {
+		_ = s.compact()
+	}
+}
+
+// Compact rewrites the log with only the live entries, dropping
+// superseded and deleted records
+func (s *LogStore) Compact() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.compact()
+}
+
+// compact does the work of Compact. The caller must hold the lock.
+func (s *LogStore) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".cachelog-*")
+	if err != nil {
+		return fmt.Errorf("error creating compacted cache log: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	index := make(map[string]logPos, len(s.index))
+	var offset int64
+	for key, pos := range s.index {
+		line := make([]byte, pos.length)
+		if _, err := s.file.ReadAt(line, pos.offset); err != nil {
+			tmp.Close()
+			return fmt.Errorf("error reading cache log: %w", err)
+		}
+		if _, err := tmp.Write(line); err != nil {
+			tmp.Close()
+			return fmt.Errorf("error writing compacted cache log: %w", err)
+		}
+		pos.offset = offset
+		index[key] = pos
+		offset += int64(pos.length)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing compacted cache log: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("error replacing cache log: %w", err)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("error reopening cache log: %w", err)
+	}
+	s.file.Close()
+	s.file = file
+	s.size = offset
+	s.live = offset
+	s.index = index
+	return nil
+}
+
+// Close closes the log file
+func (s *LogStore) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.file.Close()
+}
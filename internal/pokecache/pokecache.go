@@ -1,90 +1,580 @@
 package pokecache
 
 import (
+	"container/list"
+	"sort"
 	"sync"
 	"time"
 )
 
-var mux = &sync.RWMutex{}
+// NoExpiry pins an entry added with AddWithTTL so the reaper never removes it
+const NoExpiry time.Duration = -1
 
-type cacheEntry struct {
-	createdAt time.Time
-	val       []byte
+// Stats is a snapshot of a cache's counters and current size
+type Stats struct {
+	Hits        int
+	StaleHits   int
+	Misses      int
+	Evictions   int
+	Expirations int
+	Bytes       int // stored size of keys and values, after compression
+	RawBytes    int // the same before compression
+	Entries     int
 }
 
-// Cache holds in-memory Pokemon cache data
+// CompressionRatio is how many times smaller the stored values are than
+// the originals, or 1 when nothing is compressed
+func (s Stats) CompressionRatio() float64 {
+	if s.Bytes == 0 {
+		return 1
+	}
+	return float64(s.RawBytes) / float64(s.Bytes)
+}
+
+// Cache holds in-memory Pokemon cache data.
+// When limits are set, the least recently used entries are evicted to stay within them.
 type Cache struct {
-	store map[string]cacheEntry
+	mux          sync.RWMutex
+	store        map[string]*list.Element
+	lru          *list.List // front is most recently used
+	index        keyIndex
+	stored       keyIndex // keys in the backing store; complete once storedListed is set
+	storedListed bool
+	bytes        int
+	rawBytes     int
+	compressAt   int
+	interval     time.Duration
+	retention    time.Duration
+	maxBytes     int
+	maxEntries   int
+	backend      Store
+	clock        Clock
+	stats        Stats
+	listeners    []EvictFunc
+	evicted      []eviction // reported to listeners once the lock is released
+	done         chan struct{}
+	closeOnce    sync.Once
+	reaperWG     sync.WaitGroup
+}
+
+// Option configures optional Cache behaviour in NewCache.
+type Option func(*Cache)
+
+// WithMaxBytes limits the total size of keys and values held by the cache.
+// Zero means no limit.
+func WithMaxBytes(n int) Option {
+	return func(c *Cache) {
+		c.maxBytes = n
+	}
+}
+
+// WithMaxEntries limits the number of entries held by the cache.
+// Zero means no limit.
+func WithMaxEntries(n int) Option {
+	return func(c *Cache) {
+		c.maxEntries = n
+	}
+}
+
+// WithStore adds a backing store below the in-memory tier.
+// Memory misses fall back to the store, and every Add is written through to it.
+// The cache takes ownership of the store and closes it in Close.
+func WithStore(store Store) Option {
+	return func(c *Cache) {
+		c.backend = store
+	}
+}
+
+// WithDiskDir is shorthand for WithStore(NewDirStore(dir))
+func WithDiskDir(dir string) Option {
+	return WithStore(NewDirStore(dir))
+}
+
+// WithStaleRetention keeps expired entries around as stale for d past their TTL.
+// Stale entries are invisible to Get but can still be read with GetStale,
+// for example when the origin is unreachable. By default expired entries are dropped.
+func WithStaleRetention(d time.Duration) Option {
+	return func(c *Cache) {
+		c.retention = d
+	}
 }
 
-// NewCache creates and returns a new Cache instance
-func NewCache(interval time.Duration) *Cache {
+// NewCache creates and returns a new Cache instance.
+// The interval is both how often the reaper runs and the TTL used by Add.
+// Call Close when the cache is no longer needed to stop its reaper.
+func NewCache(interval time.Duration, opts ...Option) *Cache {
 	c := &Cache{
-		store: make(map[string]cacheEntry),
+		store:    make(map[string]*list.Element),
+		lru:      list.New(),
+		interval: interval,
+		clock:    realClock{},
+		done:     make(chan struct{}),
 	}
-	go c.reapLoop(interval)
+	for _, opt := range opts {
+		opt(c)
+	}
+	// The ticker is created before the reaper starts, so a fake clock
+	// advanced right after NewCache returns still fires it
+	c.reaperWG.Add(1)
+	go c.reapLoop(c.clock.NewTicker(interval))
 	return c
 }
 
-// Get returns a stored value identified by key
+// Close stops the background reaper and closes the backing store, if any.
+// It is safe to call more than once.
+func (c *Cache) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.reaperWG.Wait()
+		if c.backend != nil {
+			_ = c.backend.Close()
+		}
+	})
+}
+
+// Get returns a stored value identified by key and marks it as recently used.
+// Entries past their TTL are treated as missing even before the reaper removes them.
+// On a memory miss the backing store, if any, is consulted and a hit is loaded back into memory.
 func (c *Cache) Get(key string) ([]byte, bool) {
-	mux.RLock()
-	defer mux.RUnlock()
-	entry, exists := c.store[key]
-	// if exists {
-	//     fmt.Printf("Cache hit for key: %s\n", key)
-	// } else {
-	//     fmt.Printf("Cache miss for key: %s\n", key)
-	// }
-	return entry.val, exists
-}
-
-// Add stores a value in the cache with the given key
+	entry, found := c.getFresh(key)
+	if !found {
+		return nil, false
+	}
+	val, err := entry.plain()
+	if err != nil {
+		c.Delete(key)
+		return nil, false
+	}
+	return val, true
+}
+
+// getFresh returns the entry for key if it has not expired, counting the hit or miss
+func (c *Cache) getFresh(key string) (*Entry, bool) {
+	now := c.clock.Now()
+	entry, found := c.lookup(key, now)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if !found || entry.Expired(now) {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	return entry, true
+}
+
+// GetStale returns the value for key even if it has expired, as long as it is
+// still within the stale retention window. The stale result reports whether
+// the value is past its TTL.
+func (c *Cache) GetStale(key string) (val []byte, stale, found bool) {
+	now := c.clock.Now()
+	entry, found := c.lookup(key, now)
+	if !found {
+		return nil, false, false
+	}
+
+	c.mux.Lock()
+	stale = entry.Expired(now)
+	if stale {
+		c.stats.StaleHits++
+	} else {
+		c.stats.Hits++
+	}
+	c.mux.Unlock()
+
+	val, err := entry.plain()
+	if err != nil {
+		c.Delete(key)
+		return nil, false, false
+	}
+	return val, stale, true
+}
+
+// lookup finds the entry for key in memory or in the backing store, marking it as recently used.
+// Entries past the stale retention window are discarded and never returned.
+func (c *Cache) lookup(key string, now time.Time) (*Entry, bool) {
+	c.mux.Lock()
+	if elem, exists := c.store[key]; exists {
+		entry := elem.Value.(*Entry)
+		if !c.discardable(entry, now) {
+			c.lru.MoveToFront(elem)
+			c.mux.Unlock()
+			return entry, true
+		}
+	}
+	c.mux.Unlock()
+
+	if c.backend == nil {
+		return nil, false
+	}
+	stored, found := c.backend.Get(key)
+	if !found {
+		// The store drops corrupt entries, so make sure the key is not listed
+		c.mux.Lock()
+		c.stored.remove(key)
+		c.mux.Unlock()
+		return nil, false
+	}
+	entry := &stored
+
+	c.mux.Lock()
+	defer c.unlockAndNotify()
+	if c.discardable(entry, now) {
+		_ = c.backend.Delete(key)
+		c.stored.remove(key)
+		c.stats.Expirations++
+		c.recordEviction(entry, EvictExpired)
+		return nil, false
+	}
+	c.insert(entry)
+	return entry, true
+}
+
+// discardable reports whether the entry is past both its TTL and the stale retention window
+func (c *Cache) discardable(e *Entry, now time.Time) bool {
+	return e.Expired(now.Add(-c.retention))
+}
+
+// Add stores a value in the cache with the given key, using the cache's default TTL
 func (c *Cache) Add(key string, value []byte) {
-	mux.Lock()
-	defer mux.Unlock()
-	c.store[key] = cacheEntry{
-		createdAt: time.Now(),
-		val:       value,
+	c.AddWithTTL(key, value, c.interval)
+}
+
+// AddWithTTL stores a value that expires after ttl. Pass NoExpiry to pin the entry.
+// Values larger than the cache's byte budget are not stored.
+func (c *Cache) AddWithTTL(key string, value []byte, ttl time.Duration) {
+	c.AddWithValidators(key, value, ttl, Validators{})
+}
+
+// AddWithValidators stores a value that expires after ttl together with its HTTP validators
+func (c *Cache) AddWithValidators(key string, value []byte, ttl time.Duration, validators Validators) {
+	c.add(&Entry{
+		Key:        key,
+		CreatedAt:  c.clock.Now(),
+		TTL:        ttl,
+		Value:      value,
+		Validators: validators,
+	})
+}
+
+// Validators returns the HTTP validators stored with key, even if the entry is stale
+func (c *Cache) Validators(key string) (Validators, bool) {
+	entry, found := c.lookup(key, c.clock.Now())
+	if !found {
+		return Validators{}, false
 	}
+	return entry.Validators, true
+}
+
+// Refresh makes an existing entry, even a stale one, fresh again for ttl
+// without replacing its value. It reports whether the key was found.
+func (c *Cache) Refresh(key string, ttl time.Duration) bool {
+	return c.RefreshWithValidators(key, ttl, Validators{})
+}
+
+// RefreshWithValidators refreshes an entry like Refresh, as after a 304 Not Modified,
+// and replaces its stored validators with any non-empty ones given. The value is
+// kept as it is, so it is neither recompressed nor decoded again by a TypedCache.
+func (c *Cache) RefreshWithValidators(key string, ttl time.Duration, validators Validators) bool {
+	entry, found := c.lookup(key, c.clock.Now())
+	if !found {
+		return false
+	}
+	c.mux.RLock()
+	refreshed := *entry
+	c.mux.RUnlock()
+	refreshed.CreatedAt = c.clock.Now()
+	refreshed.TTL = ttl
+	if validators.ETag != "" {
+		refreshed.Validators.ETag = validators.ETag
+	}
+	if validators.LastModified != "" {
+		refreshed.Validators.LastModified = validators.LastModified
+	}
+	c.add(&refreshed)
+	return true
+}
+
+// add writes entry through to the backing store and stores it in memory,
+// compressing it first if it is large enough. Values over the byte limit
+// are not cached in either tier, and any older copy is dropped from both.
+func (c *Cache) add(entry *Entry) {
+	entry = c.compress(entry)
+	if c.backend != nil {
+		// The backing store is best effort; a failed write only costs a refetch later
+		if c.tooLarge(entry) {
+			_ = c.backend.Delete(entry.Key)
+		} else {
+			_ = c.backend.Add(*entry)
+		}
+	}
+
+	c.mux.Lock()
+	defer c.unlockAndNotify()
+	if c.backend != nil {
+		if c.tooLarge(entry) {
+			c.stored.remove(entry.Key)
+		} else {
+			c.stored.insert(entry.Key)
+		}
+	}
+	c.insert(entry)
+}
+
+// insert places entry in the memory tier and evicts as needed.
+// The caller must hold the write lock.
+func (c *Cache) insert(entry *Entry) {
+	key := entry.Key
+	if c.tooLarge(entry) {
+		c.remove(key, EvictLRU)
+		c.stats.Evictions++
+		return
+	}
+
+	if elem, exists := c.store[key]; exists {
+		c.bytes -= elem.Value.(*Entry).size()
+		c.rawBytes -= elem.Value.(*Entry).rawSize()
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+	} else {
+		c.store[key] = c.lru.PushFront(entry)
+		c.index.insert(key)
+	}
+	c.bytes += entry.size()
+	c.rawBytes += entry.rawSize()
+	c.evict()
+}
+
+// Pin removes the expiry from an existing entry. It reports whether the key was found.
+func (c *Cache) Pin(key string) bool {
+	return c.Refresh(key, NoExpiry)
 }
 
 // Delete removes the value associated with the key from the cache.
 func (c *Cache) Delete(key string) {
-	mux.Lock()
-	defer mux.Unlock()
-	delete(c.store, key)
+	c.mux.Lock()
+	defer c.unlockAndNotify()
+	c.remove(key, EvictDeleted)
+	if c.backend != nil {
+		_ = c.backend.Delete(key)
+		c.stored.remove(key)
+	}
 }
 
-// GetKeysWithPrefix returns all keys in the cache that have the given prefix
-func (c *Cache) GetKeysWithPrefix(prefix string) []string {
-	mux.RLock()
-	defer mux.RUnlock()
+// Clear removes every entry from the cache, including any in the backing store.
+// Counters are kept so stats still describe the whole session.
+func (c *Cache) Clear() {
+	c.mux.Lock()
+	defer c.unlockAndNotify()
+	for _, elem := range c.store {
+		c.recordEviction(elem.Value.(*Entry), EvictCleared)
+	}
+	c.store = make(map[string]*list.Element)
+	c.lru.Init()
+	c.index.reset()
+	c.bytes = 0
+	c.rawBytes = 0
+	if c.backend != nil {
+		_ = c.backend.Clear()
+		c.stored.reset()
+		c.storedListed = true
+	}
+}
+
+// Stats returns the cache's counters along with its current size in memory
+func (c *Cache) Stats() Stats {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	stats := c.stats
+	stats.Bytes = c.bytes
+	stats.RawBytes = c.rawBytes
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+// Keys returns the keys that start with prefix, in sorted order. Keys in
+// the backing store are included, even if they have not been loaded into memory.
+// The store is listed once and tracked from then on, so entries added to it by
+// other processes afterwards are not included.
+func (c *Cache) Keys(prefix string) []string {
+	if c.backend != nil {
+		c.loadStoredKeys()
+	}
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	keys := c.index.withPrefix(prefix)
+	if c.backend == nil {
+		return keys
+	}
+	return mergeSorted(keys, c.stored.withPrefix(prefix))
+}
+
+// loadStoredKeys lists the backing store the first time it is needed. Keys
+// written or removed through the cache since then are already tracked.
+func (c *Cache) loadStoredKeys() {
+	c.mux.RLock()
+	loaded := c.storedListed
+	c.mux.RUnlock()
+	if loaded {
+		return
+	}
+	// The backing store is best effort; if it can't be listed, try again next time
+	keys, err := c.backend.Keys()
+	if err != nil {
+		return
+	}
+	sort.Strings(keys)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.storedListed {
+		return
+	}
+	listed := keyIndex{keys: keys}
+	for _, key := range c.stored.keys {
+		listed.insert(key)
+	}
+	c.stored = listed
+	c.storedListed = true
+}
 
-	var keys []string
-	for key := range c.store {
-		if len(key) >= len(prefix) && key[:len(prefix)] == prefix {
-			keys = append(keys, key[len(prefix):])
+// mergeSorted merges two sorted key lists, dropping duplicates
+func mergeSorted(a, b []string) []string {
+	merged := make([]string, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		switch {
+		case len(b) == 0 || (len(a) > 0 && a[0] < b[0]):
+			merged = append(merged, a[0])
+			a = a[1:]
+		case len(a) == 0 || b[0] < a[0]:
+			merged = append(merged, b[0])
+			b = b[1:]
+		default:
+			merged = append(merged, a[0])
+			a, b = a[1:], b[1:]
 		}
 	}
+	return merged
+}
+
+// Range calls fn for each fresh entry in memory whose key starts with prefix,
+// in key order, until fn returns false. Values must not be modified.
+// Range does not affect recency or stats.
+func (c *Cache) Range(prefix string, fn func(key string, val []byte) bool) {
+	c.mux.RLock()
+	keys := c.index.withPrefix(prefix)
+	c.mux.RUnlock()
+
+	for _, key := range keys {
+		c.mux.RLock()
+		elem, exists := c.store[key]
+		var entry *Entry
+		if exists {
+			entry = elem.Value.(*Entry)
+		}
+		c.mux.RUnlock()
+
+		if entry == nil || entry.Expired(c.clock.Now()) {
+			continue
+		}
+		val, err := entry.plain()
+		if err != nil {
+			continue
+		}
+		if !fn(key, val) {
+			return
+		}
+	}
+}
 
+// GetKeysWithPrefix returns all keys in the cache that have the given prefix, with the prefix removed
+func (c *Cache) GetKeysWithPrefix(prefix string) []string {
+	keys := c.Keys(prefix)
+	for i, key := range keys {
+		keys[i] = key[len(prefix):]
+	}
 	return keys
 }
 
-func (c *Cache) reapLoop(interval time.Duration) {
+// remove deletes key from the cache, queueing it for OnEvict callbacks.
+// The caller must hold the write lock.
+func (c *Cache) remove(key string, reason EvictReason) {
+	elem, exists := c.store[key]
+	if !exists {
+		return
+	}
+	c.recordEviction(elem.Value.(*Entry), reason)
+	c.bytes -= elem.Value.(*Entry).size()
+	c.rawBytes -= elem.Value.(*Entry).rawSize()
+	c.lru.Remove(elem)
+	delete(c.store, key)
+	c.index.remove(key)
+}
+
+// evict drops least recently used entries until the cache is within its limits.
+// The caller must hold the write lock.
+func (c *Cache) evict() {
+	for c.overLimit() {
+		oldest := c.lru.Back()
+		if oldest == nil {
+			return
+		}
+		c.remove(oldest.Value.(*Entry).Key, EvictLRU)
+		c.stats.Evictions++
+	}
+}
+
+// tooLarge reports whether entry alone would exceed the byte limit
+func (c *Cache) tooLarge(entry *Entry) bool {
+	return c.maxBytes > 0 && entry.size() > c.maxBytes
+}
+
+func (c *Cache) overLimit() bool {
+	return (c.maxBytes > 0 && c.bytes > c.maxBytes) ||
+		(c.maxEntries > 0 && c.lru.Len() > c.maxEntries)
+}
+
+func (c *Cache) reapLoop(ticker Ticker) {
+	defer c.reaperWG.Done()
+	defer ticker.Stop()
 	for {
-		time.Sleep(interval)
-		c.clearExpired(interval)
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C():
+			c.clearExpired()
+		}
 	}
 }
 
-func (c *Cache) clearExpired(interval time.Duration) {
-	mux.Lock()
-	defer mux.Unlock()
-	for key, entry := range c.store {
-		if time.Since(entry.createdAt) > interval {
-			// fmt.Printf("Removing expired cache entry for: %s\n", key)
-			delete(c.store, key)
+func (c *Cache) clearExpired() {
+	now := c.clock.Now()
+
+	c.mux.Lock()
+	expired := 0
+	for key, elem := range c.store {
+		if c.discardable(elem.Value.(*Entry), now) {
+			c.remove(key, EvictExpired)
+			expired++
 		}
 	}
+	c.unlockAndNotify()
+
+	if c.backend != nil {
+		// Every entry is written through to the store, so its count covers the memory tier
+		// as well as entries that were already evicted from memory
+		removed, err := c.backend.DeleteExpired(now.Add(-c.retention))
+		if err == nil {
+			expired = len(removed)
+		}
+		c.mux.Lock()
+		for _, key := range removed {
+			c.stored.remove(key)
+		}
+		c.mux.Unlock()
+	}
+
+	c.mux.Lock()
+	c.stats.Expirations += expired
+	c.mux.Unlock()
 }
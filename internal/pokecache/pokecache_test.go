@@ -0,0 +1,488 @@
+package pokecache
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddGet(t *testing.T) {
+	cache := NewCache(time.Minute)
+	defer cache.Close()
+
+	cache.Add("https://example.com", []byte("testdata"))
+	val, ok := cache.Get("https://example.com")
+	if !ok {
+		t.Fatal("Expected to find key")
+	}
+	if string(val) != "testdata" {
+		t.Errorf("Expected value %q, got %q", "testdata", val)
+	}
+}
+
+func TestReapLoop(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCache(time.Minute, WithClock(clock))
+	defer cache.Close()
+
+	cache.Add("https://example.com/expired", []byte("old"))
+	cache.AddWithTTL("https://example.com/fresh", []byte("new"), time.Hour)
+	cache.AddWithTTL("https://example.com/pinned", []byte("pinned"), NoExpiry)
+	clock.Advance(time.Minute)
+	clock.Advance(time.Minute)
+
+	deadline := time.Now().Add(time.Second)
+	for cache.Stats().Expirations != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the reaper to expire 1 entry, got %+v", cache.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if stats := cache.Stats(); stats.Entries != 2 {
+		t.Errorf("Expected the reaper to keep the fresh and pinned entries, got %+v", stats)
+	}
+}
+
+func TestCachesDoNotShareState(t *testing.T) {
+	first := NewCache(time.Minute)
+	defer first.Close()
+	second := NewCache(time.Minute)
+	defer second.Close()
+
+	first.Add("key", []byte("first"))
+	if _, ok := second.Get("key"); ok {
+		t.Error("Expected second cache not to see entries from the first")
+	}
+}
+
+func TestCloseStopsReaper(t *testing.T) {
+	cache := NewCache(time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		cache.Close()
+		cache.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return")
+	}
+}
+
+func TestAddWithTTL(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCache(time.Minute, WithClock(clock))
+	defer cache.Close()
+
+	cache.AddWithTTL("short", []byte("short"), time.Minute)
+	cache.AddWithTTL("long", []byte("long"), time.Hour)
+	cache.AddWithTTL("pinned", []byte("pinned"), NoExpiry)
+	clock.Advance(2 * time.Minute)
+
+	if _, ok := cache.Get("short"); ok {
+		t.Error("Expected short-lived entry to expire")
+	}
+	if _, ok := cache.Get("long"); !ok {
+		t.Error("Expected long-lived entry to survive")
+	}
+	if _, ok := cache.Get("pinned"); !ok {
+		t.Error("Expected pinned entry to survive")
+	}
+}
+
+func TestPin(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCache(time.Minute, WithClock(clock))
+	defer cache.Close()
+
+	cache.Add("key", []byte("value"))
+	if !cache.Pin("key") {
+		t.Fatal("Expected Pin to find the key")
+	}
+	if cache.Pin("missing") {
+		t.Error("Expected Pin to report a missing key")
+	}
+	clock.Advance(time.Hour)
+
+	if _, ok := cache.Get("key"); !ok {
+		t.Error("Expected pinned entry to survive the reaper")
+	}
+}
+
+func TestMaxEntriesEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewCache(time.Minute, WithMaxEntries(2))
+	defer cache.Close()
+
+	cache.Add("a", []byte("1"))
+	cache.Add("b", []byte("2"))
+	cache.Get("a") // a is now more recent than b
+	cache.Add("c", []byte("3"))
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("Expected %q to remain in the cache", key)
+		}
+	}
+}
+
+func TestMaxBytesEvictsLeastRecentlyUsed(t *testing.T) {
+	// Each entry is a one-byte key plus a four-byte value
+	cache := NewCache(time.Minute, WithMaxBytes(10))
+	defer cache.Close()
+
+	cache.Add("a", []byte("1111"))
+	cache.Add("b", []byte("2222"))
+	cache.Add("c", []byte("3333"))
+
+	if _, ok := cache.Get("a"); ok {
+		t.Error("Expected oldest entry to be evicted to fit the byte budget")
+	}
+
+	cache.Add("huge", make([]byte, 64))
+	if _, ok := cache.Get("huge"); ok {
+		t.Error("Expected a value larger than the budget not to be stored")
+	}
+	if _, ok := cache.Get("c"); !ok {
+		t.Error("Expected existing entries to survive an oversized add")
+	}
+}
+
+func TestOversizedValuesAreNotCached(t *testing.T) {
+	store := NewMemoryStore()
+	cache := NewCache(time.Minute, WithMaxBytes(10), WithStore(store))
+	defer cache.Close()
+
+	cache.Add("k", []byte("1111"))
+	cache.Add("k", make([]byte, 64))
+
+	if _, ok := cache.Get("k"); ok {
+		t.Error("Expected an oversized value not to be served, nor the copy it replaced")
+	}
+	if _, ok := store.Get("k"); ok {
+		t.Error("Expected an oversized value not to be persisted")
+	}
+	if got := cache.Stats().Evictions; got != 1 {
+		t.Errorf("Expected the rejected value to count as 1 eviction, got %d", got)
+	}
+}
+
+func TestDiskTierSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	first := NewCache(time.Minute, WithDiskDir(dir))
+	first.Add("https://example.com", []byte("testdata"))
+	first.Close()
+
+	second := NewCache(time.Minute, WithDiskDir(dir))
+	defer second.Close()
+
+	val, ok := second.Get("https://example.com")
+	if !ok {
+		t.Fatal("Expected entry to be loaded from disk")
+	}
+	if string(val) != "testdata" {
+		t.Errorf("Expected value %q, got %q", "testdata", val)
+	}
+
+	second.Delete("https://example.com")
+	third := NewCache(time.Minute, WithDiskDir(dir))
+	defer third.Close()
+	if _, ok := third.Get("https://example.com"); ok {
+		t.Error("Expected Delete to remove the entry from disk")
+	}
+}
+
+func TestDiskTierHonoursTTL(t *testing.T) {
+	dir := t.TempDir()
+	clock := NewFakeClock(time.Now())
+
+	first := NewCache(time.Minute, WithDiskDir(dir), WithClock(clock))
+	first.AddWithTTL("key", []byte("value"), time.Minute)
+	first.Close()
+	clock.Advance(2 * time.Minute)
+
+	second := NewCache(time.Minute, WithDiskDir(dir), WithClock(clock))
+	defer second.Close()
+	if _, ok := second.Get("key"); ok {
+		t.Error("Expected expired disk entry to be ignored")
+	}
+}
+
+func TestStats(t *testing.T) {
+	cache := NewCache(time.Minute, WithMaxEntries(1))
+	defer cache.Close()
+
+	cache.Add("a", []byte("1"))
+	cache.Get("a")
+	cache.Get("missing")
+	cache.Add("b", []byte("2"))
+
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Evictions != 1 {
+		t.Errorf("Expected 1 hit, 1 miss and 1 eviction, got %+v", stats)
+	}
+	if stats.Entries != 1 || stats.Bytes != 2 {
+		t.Errorf("Expected 1 entry of 2 bytes, got %+v", stats)
+	}
+
+	cache.Clear()
+	if keys := cache.Keys(""); len(keys) != 0 {
+		t.Errorf("Expected no keys after Clear, got %v", keys)
+	}
+}
+
+func TestStaleRetention(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCache(time.Minute, WithStaleRetention(time.Hour), WithClock(clock))
+	defer cache.Close()
+
+	cache.AddWithTTL("key", []byte("value"), time.Minute)
+	clock.Advance(2 * time.Minute)
+
+	if _, ok := cache.Get("key"); ok {
+		t.Error("Expected Get to ignore a stale entry")
+	}
+	val, stale, found := cache.GetStale("key")
+	if !found || !stale {
+		t.Fatalf("Expected a stale entry, got found=%v stale=%v", found, stale)
+	}
+	if string(val) != "value" {
+		t.Errorf("Expected value %q, got %q", "value", val)
+	}
+
+	clock.Advance(2 * time.Hour)
+	if _, _, found := cache.GetStale("key"); found {
+		t.Error("Expected entry past the retention window to be discarded")
+	}
+}
+
+func TestReaperWithFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCache(time.Minute, WithClock(clock))
+	defer cache.Close()
+
+	cache.Add("key", []byte("value"))
+	clock.Advance(time.Minute)
+	clock.Advance(time.Minute)
+
+	deadline := time.Now().Add(time.Second)
+	for cache.Stats().Expirations != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the reaper to expire 1 entry, got %+v", cache.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Errorf("Expected the reaper to remove the entry, got %+v", stats)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	source := NewCache(time.Minute, WithClock(clock))
+	defer source.Close()
+	source.AddWithTTL("long", []byte("long"), time.Hour)
+	source.AddWithTTL("pinned", []byte("pinned"), NoExpiry)
+	source.AddWithTTL("expired", []byte("expired"), time.Minute)
+	clock.Advance(2 * time.Minute)
+
+	var buf bytes.Buffer
+	if err := source.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+
+	target := NewCache(time.Minute, WithClock(clock))
+	defer target.Close()
+	if err := target.Restore(&buf); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	for _, key := range []string{"long", "pinned"} {
+		if val, ok := target.Get(key); !ok || string(val) != key {
+			t.Errorf("Expected %q to be restored, got %q (found=%v)", key, val, ok)
+		}
+	}
+	if _, ok := target.Get("expired"); ok {
+		t.Error("Expected expired entry not to be restored")
+	}
+	if !target.Refresh("long", time.Hour) {
+		t.Error("Expected restored entry to keep its metadata")
+	}
+}
+
+func TestRestoreAcceptsVersionOne(t *testing.T) {
+	cache := NewCache(time.Minute)
+	defer cache.Close()
+
+	created := time.Now().Format(time.RFC3339Nano)
+	snap := `{"version":1,"entries":[{"key":"pikachu","value":"ZGF0YQ==","created_at":"` + created + `","ttl":3600000000000}]}`
+	if err := cache.Restore(strings.NewReader(snap)); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if val, ok := cache.Get("pikachu"); !ok || string(val) != "data" {
+		t.Errorf("Expected the version 1 entry to be restored, got %q (found=%v)", val, ok)
+	}
+}
+
+func TestRestoreRejectsUnknownVersion(t *testing.T) {
+	cache := NewCache(time.Minute)
+	defer cache.Close()
+	if err := cache.Restore(strings.NewReader(`{"version":99,"entries":[]}`)); err == nil {
+		t.Error("Expected an error for an unknown snapshot version")
+	}
+}
+
+func TestKeysAreSortedByPrefix(t *testing.T) {
+	cache := NewCache(time.Minute)
+	defer cache.Close()
+
+	for _, key := range []string{"pokemon/pikachu", "area/b", "pokemon/abra", "area/a", "pokemonx"} {
+		cache.Add(key, []byte(key))
+	}
+	cache.Delete("area/b")
+
+	keys := cache.Keys("pokemon/")
+	expected := []string{"pokemon/abra", "pokemon/pikachu"}
+	if len(keys) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, keys)
+	}
+	for i := range expected {
+		if keys[i] != expected[i] {
+			t.Errorf("Expected %q at position %d, got %q", expected[i], i, keys[i])
+		}
+	}
+
+	var ranged []string
+	cache.Range("area/", func(key string, val []byte) bool {
+		ranged = append(ranged, key)
+		return true
+	})
+	if len(ranged) != 1 || ranged[0] != "area/a" {
+		t.Errorf("Expected Range to visit only area/a, got %v", ranged)
+	}
+}
+
+// listCountingStore counts how often the store is listed in full
+type listCountingStore struct {
+	*MemoryStore
+	lists int
+}
+
+func (s *listCountingStore) Keys() ([]string, error) {
+	s.lists++
+	return s.MemoryStore.Keys()
+}
+
+func TestKeysIncludeBackingStore(t *testing.T) {
+	store := &listCountingStore{MemoryStore: NewMemoryStore()}
+	store.Add(Entry{Key: "pokemon/zubat", Value: []byte("z"), CreatedAt: time.Now(), TTL: time.Hour})
+	store.Add(Entry{Key: "area/a", Value: []byte("a"), CreatedAt: time.Now(), TTL: time.Hour})
+	cache := NewCache(time.Minute, WithStore(store))
+	defer cache.Close()
+
+	cache.Add("pokemon/abra", []byte("abra"))
+
+	keys := cache.Keys("pokemon/")
+	expected := []string{"pokemon/abra", "pokemon/zubat"}
+	if fmt.Sprint(keys) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, keys)
+	}
+
+	// Later changes are tracked without listing the store again
+	cache.Delete("pokemon/zubat")
+	cache.Add("pokemon/mew", []byte("mew"))
+	keys = cache.Keys("pokemon/")
+	expected = []string{"pokemon/abra", "pokemon/mew"}
+	if fmt.Sprint(keys) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, keys)
+	}
+	if store.lists != 1 {
+		t.Errorf("Expected the store to be listed once, got %d", store.lists)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewCache(time.Minute, WithCompression(64), WithDiskDir(dir))
+	defer cache.Close()
+
+	large := []byte(strings.Repeat(`{"name":"canalave-city-area"},`, 100))
+	cache.Add("large", large)
+	cache.Add("small", []byte("tiny"))
+
+	for key, expected := range map[string][]byte{"large": large, "small": []byte("tiny")} {
+		val, ok := cache.Get(key)
+		if !ok || !bytes.Equal(val, expected) {
+			t.Errorf("Expected %q to round-trip, got %d bytes (found=%v)", key, len(val), ok)
+		}
+	}
+
+	stats := cache.Stats()
+	if stats.Bytes >= stats.RawBytes {
+		t.Errorf("Expected stored bytes below raw bytes, got %+v", stats)
+	}
+	if ratio := stats.CompressionRatio(); ratio <= 1 {
+		t.Errorf("Expected a compression ratio above 1, got %.2f", ratio)
+	}
+
+	plain := NewCache(time.Minute, WithCompression(64))
+	defer plain.Close()
+	plain.Add("https://pokeapi.co/api/v2/location-area/canalave-city-area", []byte("tiny"))
+	if ratio := plain.Stats().CompressionRatio(); ratio != 1 {
+		t.Errorf("Expected a compression ratio of 1 with nothing compressed, got %.2f", ratio)
+	}
+
+	// Entries stay compressed in the backing store and still read back correctly
+	reopened := NewCache(time.Minute, WithDiskDir(dir))
+	defer reopened.Close()
+	if val, ok := reopened.Get("large"); !ok || !bytes.Equal(val, large) {
+		t.Errorf("Expected compressed entry to load from disk, got %d bytes (found=%v)", len(val), ok)
+	}
+}
+
+func TestOnEvict(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	// The reaper interval is longer than the test advances, so only the
+	// explicit clearExpired call below expires anything
+	cache := NewCache(time.Hour, WithMaxEntries(2), WithClock(clock))
+	defer cache.Close()
+
+	reasons := make(map[string]EvictReason)
+	cache.OnEvict(func(key string, val []byte, reason EvictReason) {
+		if string(val) != key {
+			t.Errorf("Expected value %q for %q, got %q", key, key, val)
+		}
+		// Callbacks run without the lock held, so using the cache must not deadlock
+		cache.Stats()
+		reasons[key] = reason
+	})
+
+	cache.Add("a", []byte("a"))
+	cache.Add("b", []byte("b"))
+	cache.Add("c", []byte("c")) // evicts a
+	cache.Delete("b")
+	cache.AddWithTTL("d", []byte("d"), time.Second)
+	clock.Advance(time.Minute)
+	cache.clearExpired() // expires d
+	cache.Clear()        // clears c
+
+	expected := map[string]EvictReason{
+		"a": EvictLRU,
+		"b": EvictDeleted,
+		"c": EvictCleared,
+		"d": EvictExpired,
+	}
+	for key, reason := range expected {
+		if got, ok := reasons[key]; !ok || got != reason {
+			t.Errorf("Expected %q to be evicted as %v, got %v (reported=%v)", key, reason, got, ok)
+		}
+	}
+}
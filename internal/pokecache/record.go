@@ -0,0 +1,56 @@
+package pokecache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// recordVersion is the format version written with every persisted entry
+const recordVersion = 1
+
+// ErrCorrupt is returned when a persisted entry fails its integrity checks
+var ErrCorrupt = errors.New("corrupt cache entry")
+
+// record is the persisted form of an Entry. The checksum covers the encoded
+// entry exactly as stored, so any flipped or missing byte is detected.
+type record struct {
+	Version  int             `json:"version"`
+	Checksum uint32          `json:"checksum"`
+	Entry    json.RawMessage `json:"entry"`
+}
+
+// encodeRecord serializes entry with its format version and checksum
+func encodeRecord(entry Entry) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing cache entry: %w", err)
+	}
+	return json.Marshal(record{
+		Version:  recordVersion,
+		Checksum: crc32.ChecksumIEEE(data),
+		Entry:    data,
+	})
+}
+
+// decodeRecord parses data written by encodeRecord, returning an error
+// wrapping ErrCorrupt if it is truncated, damaged or of an unknown version
+func decodeRecord(data []byte) (Entry, error) {
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return Entry{}, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if rec.Version != recordVersion {
+		return Entry{}, fmt.Errorf("%w: unsupported format version %d", ErrCorrupt, rec.Version)
+	}
+	if crc32.ChecksumIEEE(rec.Entry) != rec.Checksum {
+		return Entry{}, fmt.Errorf("%w: checksum mismatch", ErrCorrupt)
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(rec.Entry, &entry); err != nil {
+		return Entry{}, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return entry, nil
+}
@@ -0,0 +1,106 @@
+package pokecache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// snapshotVersion is bumped whenever the snapshot format changes incompatibly
+const snapshotVersion = 2
+
+// snapshotVersionPlain is the first snapshot format, whose entries had no checksums
+const snapshotVersionPlain = 1
+
+// snapshot is the serialized form of a whole cache. Each entry is a
+// checksummed record, so one damaged entry does not spoil the rest.
+type snapshot struct {
+	Version int               `json:"version"`
+	Entries []json.RawMessage `json:"entries"`
+}
+
+// Snapshot writes every entry in the cache, including those only in the
+// backing store, to w. Creation times and TTLs are kept, so restored entries
+// expire when the originals would have.
+func (c *Cache) Snapshot(w io.Writer) error {
+	entries := make(map[string]Entry)
+
+	if c.backend != nil {
+		keys, err := c.backend.Keys()
+		if err != nil {
+			return fmt.Errorf("error listing cache store: %w", err)
+		}
+		for _, key := range keys {
+			if entry, found := c.backend.Get(key); found {
+				entries[key] = entry
+			}
+		}
+	}
+
+	c.mux.RLock()
+	for key, elem := range c.store {
+		entries[key] = *elem.Value.(*Entry)
+	}
+	c.mux.RUnlock()
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	snap := snapshot{
+		Version: snapshotVersion,
+		Entries: make([]json.RawMessage, 0, len(keys)),
+	}
+	for _, key := range keys {
+		data, err := encodeRecord(entries[key])
+		if err != nil {
+			return err
+		}
+		snap.Entries = append(snap.Entries, data)
+	}
+
+	if err := json.NewEncoder(w).Encode(snap); err != nil {
+		return fmt.Errorf("error writing cache snapshot: %w", err)
+	}
+	return nil
+}
+
+// Restore adds every entry from a snapshot written by Snapshot.
+// Entries that have expired beyond the stale retention window or fail
+// their checksum are skipped, and existing entries with the same keys are replaced.
+// Snapshots from before checksums were added are still accepted, unverified.
+func (c *Cache) Restore(r io.Reader) error {
+	var snap snapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return fmt.Errorf("error reading cache snapshot: %w", err)
+	}
+	decode := decodeRecord
+	switch snap.Version {
+	case snapshotVersion:
+	case snapshotVersionPlain:
+		decode = decodePlainEntry
+	default:
+		return fmt.Errorf("unsupported cache snapshot version %d (expected %d or %d)",
+			snap.Version, snapshotVersionPlain, snapshotVersion)
+	}
+
+	now := c.clock.Now()
+	for _, data := range snap.Entries {
+		entry, err := decode(data)
+		if err != nil || c.discardable(&entry, now) {
+			continue
+		}
+		c.add(&entry)
+	}
+	return nil
+}
+
+// decodePlainEntry reads an entry from a version 1 snapshot, which has no checksum to verify
+func decodePlainEntry(data []byte) (Entry, error) {
+	var entry Entry
+	err := json.Unmarshal(data, &entry)
+	return entry, err
+}
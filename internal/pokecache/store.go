@@ -0,0 +1,136 @@
+package pokecache
+
+import (
+	"sync"
+	"time"
+)
+
+// Validators are the HTTP validators a response was served with,
+// kept so an expired entry can be revalidated instead of downloaded again
+type Validators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// Entry is a cached value together with what is needed to expire and revalidate it.
+// Entries are never modified once stored; updates replace the whole entry.
+type Entry struct {
+	Key        string        `json:"key"`
+	Value      []byte        `json:"value"`
+	CreatedAt  time.Time     `json:"created_at"`
+	TTL        time.Duration `json:"ttl"`
+	Validators Validators    `json:"validators"`
+	Compressed bool          `json:"compressed,omitempty"`
+	RawSize    int           `json:"raw_size,omitempty"` // length of Value before compression
+
+	// decoded memoizes a TypedCache's decoded form of Value. It is the only
+	// field set after the entry is stored, and only under the cache's lock.
+	decoded any
+}
+
+// Expired reports whether the entry has outlived its TTL at the given time
+func (e *Entry) Expired(now time.Time) bool {
+	return e.TTL != NoExpiry && now.Sub(e.CreatedAt) > e.TTL
+}
+
+// size is the number of bytes the entry counts against the cache's byte budget
+func (e *Entry) size() int {
+	return len(e.Key) + len(e.Value)
+}
+
+// Store is a backend that holds cache entries below the in-memory tier.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns the entry for key, whether or not it has expired
+	Get(key string) (Entry, bool)
+	// Add stores entry, replacing any existing entry with the same key
+	Add(entry Entry) error
+	// Delete removes the entry for key, if any
+	Delete(key string) error
+	// Keys returns every key in the store
+	Keys() ([]string, error)
+	// DeleteExpired removes entries that had expired at cutoff and returns their keys
+	DeleteExpired(cutoff time.Time) ([]string, error)
+	// Clear removes every entry
+	Clear() error
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// MemoryStore is a Store that keeps entries in a map.
+// It lets several caches in one process share entries.
+type MemoryStore struct {
+	mux     sync.RWMutex
+	entries map[string]Entry
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]Entry),
+	}
+}
+
+// Get returns the entry for key
+func (s *MemoryStore) Get(key string) (Entry, bool) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	entry, exists := s.entries[key]
+	return entry, exists
+}
+
+// Add stores entry
+func (s *MemoryStore) Add(entry Entry) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.entries[entry.Key] = entry
+	return nil
+}
+
+// Delete removes the entry for key
+func (s *MemoryStore) Delete(key string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// Keys returns every key in the store
+func (s *MemoryStore) Keys() ([]string, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	keys := make([]string, 0, len(s.entries))
+	for key := range s.entries {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// DeleteExpired removes entries that had expired at cutoff
+func (s *MemoryStore) DeleteExpired(cutoff time.Time) ([]string, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var removed []string
+	for key, entry := range s.entries {
+		if entry.Expired(cutoff) {
+			delete(s.entries, key)
+			removed = append(removed, key)
+		}
+	}
+	return removed, nil
+}
+
+// Clear removes every entry
+func (s *MemoryStore) Clear() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.entries = make(map[string]Entry)
+	return nil
+}
+
+// Close does nothing; a MemoryStore holds no external resources
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,224 @@
+package pokecache
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store {
+			return NewMemoryStore()
+		},
+		"dir": func(t *testing.T) Store {
+			return NewDirStore(t.TempDir())
+		},
+		"log": func(t *testing.T) Store {
+			store, err := OpenLogStore(filepath.Join(t.TempDir(), "cache.log"))
+			if err != nil {
+				t.Fatalf("OpenLogStore() error = %v", err)
+			}
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close()
+
+			now := time.Now()
+			entries := []Entry{
+				{Key: "fresh", Value: []byte("1"), CreatedAt: now, TTL: time.Hour},
+				{Key: "old", Value: []byte("2"), CreatedAt: now.Add(-2 * time.Hour), TTL: time.Hour},
+				{Key: "pinned", Value: []byte("3"), CreatedAt: now.Add(-2 * time.Hour), TTL: NoExpiry},
+			}
+			for _, entry := range entries {
+				if err := store.Add(entry); err != nil {
+					t.Fatalf("Add(%q) error = %v", entry.Key, err)
+				}
+			}
+
+			got, ok := store.Get("fresh")
+			if !ok || string(got.Value) != "1" {
+				t.Errorf("Get(fresh) = %q, %v", got.Value, ok)
+			}
+
+			removed, err := store.DeleteExpired(now)
+			if err != nil {
+				t.Fatalf("DeleteExpired() error = %v", err)
+			}
+			if len(removed) != 1 || removed[0] != "old" {
+				t.Errorf("Expected the expired entry to be removed, got %v", removed)
+			}
+
+			if err := store.Delete("fresh"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			keys, err := store.Keys()
+			if err != nil {
+				t.Fatalf("Keys() error = %v", err)
+			}
+			sort.Strings(keys)
+			if len(keys) != 1 || keys[0] != "pinned" {
+				t.Errorf("Expected only the pinned key to remain, got %v", keys)
+			}
+
+			if err := store.Clear(); err != nil {
+				t.Fatalf("Clear() error = %v", err)
+			}
+			if _, ok := store.Get("pinned"); ok {
+				t.Error("Expected Clear to remove every entry")
+			}
+		})
+	}
+}
+
+func TestLogStoreReplayAndCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+
+	store, err := OpenLogStore(path)
+	if err != nil {
+		t.Fatalf("OpenLogStore() error = %v", err)
+	}
+	store.Add(Entry{Key: "a", Value: []byte("old"), CreatedAt: time.Now(), TTL: time.Hour})
+	store.Add(Entry{Key: "a", Value: []byte("new"), CreatedAt: time.Now(), TTL: time.Hour})
+	store.Add(Entry{Key: "b", Value: []byte("gone"), CreatedAt: time.Now(), TTL: time.Hour})
+	store.Delete("b")
+	if err := store.Compact(); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	store.Close()
+
+	reopened, err := OpenLogStore(path)
+	if err != nil {
+		t.Fatalf("OpenLogStore() on reopen error = %v", err)
+	}
+	defer reopened.Close()
+
+	if got, ok := reopened.Get("a"); !ok || string(got.Value) != "new" {
+		t.Errorf("Expected latest value for a, got %q (found=%v)", got.Value, ok)
+	}
+	if _, ok := reopened.Get("b"); ok {
+		t.Error("Expected deleted key to stay deleted after replay")
+	}
+}
+
+func TestLogStoreCompactsItself(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	store, err := OpenLogStore(path)
+	if err != nil {
+		t.Fatalf("OpenLogStore() error = %v", err)
+	}
+	defer store.Close()
+	store.compactAt = 0
+
+	for i := 0; i < 20; i++ {
+		store.Add(Entry{Key: "a", Value: []byte(fmt.Sprintf("value %d", i)), CreatedAt: time.Now(), TTL: time.Hour})
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	// One live record, plus at most as many superseded bytes again
+	if info.Size() > 2*store.live {
+		t.Errorf("Expected the log to be compacted, got %d bytes for %d live", info.Size(), store.live)
+	}
+	if got, ok := store.Get("a"); !ok || string(got.Value) != "value 19" {
+		t.Errorf("Expected the latest value after compaction, got %q (found=%v)", got.Value, ok)
+	}
+}
+
+func TestDirStoreDeleteExpiredSkipsLiveFiles(t *testing.T) {
+	dir := t.TempDir()
+	store := NewDirStore(dir)
+	now := time.Now()
+	store.Add(Entry{Key: "expired", Value: []byte("old"), CreatedAt: now.Add(-2 * time.Hour), TTL: time.Hour})
+	store.Add(Entry{Key: "fresh", Value: []byte("new"), CreatedAt: now, TTL: time.Hour})
+
+	// A live file is not read, so damage to it goes unnoticed until it is fetched
+	if err := os.WriteFile(store.path("fresh"), []byte("garbage"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	expiry := now.Add(time.Hour)
+	os.Chtimes(store.path("fresh"), expiry, expiry)
+
+	removed, err := store.DeleteExpired(now)
+	if err != nil || len(removed) != 1 {
+		t.Errorf("DeleteExpired() = %v, %v; want the expired key", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "quarantine")); !os.IsNotExist(err) {
+		t.Error("Expected DeleteExpired not to read files that have not expired")
+	}
+}
+
+func TestDirStoreQuarantinesCorruptEntries(t *testing.T) {
+	dir := t.TempDir()
+	store := NewDirStore(dir)
+	store.Add(Entry{Key: "a", Value: []byte("value"), CreatedAt: time.Now(), TTL: time.Hour})
+
+	path := store.path("a")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	data[bytes.Index(data, []byte(`"entry"`))+10] ^= 0x01
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	if _, ok := store.Get("a"); ok {
+		t.Error("Expected a corrupt entry to be treated as missing")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected the corrupt file to be moved out of the cache")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "quarantine", filepath.Base(path))); err != nil {
+		t.Errorf("Expected the corrupt file in quarantine, got %v", err)
+	}
+}
+
+func TestLogStoreSkipsCorruptRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+
+	store, err := OpenLogStore(path)
+	if err != nil {
+		t.Fatalf("OpenLogStore() error = %v", err)
+	}
+	store.Add(Entry{Key: "a", Value: []byte("old"), CreatedAt: time.Now(), TTL: time.Hour})
+	store.Add(Entry{Key: "a", Value: []byte("new"), CreatedAt: time.Now(), TTL: time.Hour})
+	store.Add(Entry{Key: "b", Value: []byte("kept"), CreatedAt: time.Now(), TTL: time.Hour})
+	store.Close()
+
+	// Damage the newest record for a without breaking the JSON around it
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	lines[1] = bytes.Replace(lines[1], []byte(`"checksum":`), []byte(`"checksum":1`), 1)
+	if err := os.WriteFile(path, bytes.Join(lines, nil), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	reopened, err := OpenLogStore(path)
+	if err != nil {
+		t.Fatalf("OpenLogStore() on reopen error = %v", err)
+	}
+	defer reopened.Close()
+
+	if got, ok := reopened.Get("a"); ok {
+		t.Errorf("Expected corrupt key to be missing, got %q", got.Value)
+	}
+	if got, ok := reopened.Get("b"); !ok || string(got.Value) != "kept" {
+		t.Errorf("Expected intact entry to survive, got %q (found=%v)", got.Value, ok)
+	}
+	if _, err := os.Stat(path + ".quarantine"); err != nil {
+		t.Errorf("Expected the corrupt record in quarantine, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package pokecache
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Codec converts values to and from the bytes a Cache stores
+type Codec[T any] interface {
+	Marshal(val T) ([]byte, error)
+	Unmarshal(data []byte) (T, error)
+}
+
+// JSONCodec is a Codec that uses encoding/json
+type JSONCodec[T any] struct{}
+
+// Marshal encodes val as JSON
+func (JSONCodec[T]) Marshal(val T) ([]byte, error) {
+	return json.Marshal(val)
+}
+
+// Unmarshal decodes JSON data into a T
+func (JSONCodec[T]) Unmarshal(data []byte) (T, error) {
+	var val T
+	err := json.Unmarshal(data, &val)
+	return val, err
+}
+
+// TypedCache is a view of a Cache that hands out decoded values.
+// Each entry is decoded at most once and the result is kept alongside its
+// bytes, so repeated hits skip deserialization. Expiry, eviction and
+// persistence are all handled by the underlying Cache, which still holds
+// the serialized form for its byte budget and backing store.
+type TypedCache[T any] struct {
+	cache *Cache
+	codec Codec[T]
+}
+
+// NewTypedCache creates a TypedCache over cache using codec
+func NewTypedCache[T any](cache *Cache, codec Codec[T]) *TypedCache[T] {
+	return &TypedCache[T]{
+		cache: cache,
+		codec: codec,
+	}
+}
+
+// Get returns the decoded value for key. Values are shared between callers,
+// so they must not be modified. An error means the stored bytes could not be
+// decoded; the entry is dropped so the caller can fetch it again.
+func (t *TypedCache[T]) Get(key string) (T, bool, error) {
+	entry, found := t.cache.getFresh(key)
+	if !found {
+		var zero T
+		return zero, false, nil
+	}
+	return t.decode(key, entry)
+}
+
+// Load returns the decoded value for key like Get, even if it is stale, without
+// counting a hit or a miss. It suits callers that have just stored or refreshed
+// the entry through the underlying Cache and want its value.
+func (t *TypedCache[T]) Load(key string) (T, bool, error) {
+	entry, found := t.cache.lookup(key, t.cache.clock.Now())
+	if !found {
+		var zero T
+		return zero, false, nil
+	}
+	return t.decode(key, entry)
+}
+
+// decode returns entry's value, decoding it the first time and keeping the result
+func (t *TypedCache[T]) decode(key string, entry *Entry) (T, bool, error) {
+	var zero T
+	t.cache.mux.RLock()
+	val, ok := entry.decoded.(T)
+	t.cache.mux.RUnlock()
+	if ok {
+		return val, true, nil
+	}
+
+	data, err := entry.plain()
+	if err != nil {
+		t.cache.Delete(key)
+		return zero, false, err
+	}
+	val, err = t.codec.Unmarshal(data)
+	if err != nil {
+		t.cache.Delete(key)
+		return zero, false, err
+	}
+	t.cache.mux.Lock()
+	entry.decoded = val
+	t.cache.mux.Unlock()
+	return val, true, nil
+}
+
+// Add serializes val and stores it for ttl. The decoded value is kept too,
+// so the next Get does not have to decode it.
+func (t *TypedCache[T]) Add(key string, val T, ttl time.Duration) error {
+	data, err := t.codec.Marshal(val)
+	if err != nil {
+		return err
+	}
+	t.cache.add(&Entry{
+		Key:       key,
+		Value:     data,
+		CreatedAt: t.cache.clock.Now(),
+		TTL:       ttl,
+		decoded:   val,
+	})
+	return nil
+}
+
+// Delete removes the value for key
+func (t *TypedCache[T]) Delete(key string) {
+	t.cache.Delete(key)
+}
+
+// Close closes the underlying Cache
+func (t *TypedCache[T]) Close() {
+	t.cache.Close()
+}
@@ -0,0 +1,92 @@
+package pokecache
+
+import (
+	"testing"
+	"time"
+)
+
+type countingCodec struct {
+	JSONCodec[[]string]
+	decodes int
+}
+
+func (c *countingCodec) Unmarshal(data []byte) ([]string, error) {
+	c.decodes++
+	return c.JSONCodec.Unmarshal(data)
+}
+
+func TestTypedCacheDecodesOnce(t *testing.T) {
+	cache := NewCache(time.Minute)
+	defer cache.Close()
+
+	codec := &countingCodec{}
+	typed := NewTypedCache[[]string](cache, codec)
+
+	cache.Add("names", []byte(`["pikachu","bulbasaur"]`))
+	for i := 0; i < 3; i++ {
+		names, found, err := typed.Get("names")
+		if err != nil || !found {
+			t.Fatalf("Get() = %v, %v, %v", names, found, err)
+		}
+		if len(names) != 2 || names[0] != "pikachu" {
+			t.Errorf("Unexpected value %v", names)
+		}
+	}
+	if codec.decodes != 1 {
+		t.Errorf("Expected 1 decode, got %d", codec.decodes)
+	}
+
+	if err := typed.Add("added", []string{"eevee"}, time.Minute); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, found, _ := typed.Get("added"); !found {
+		t.Error("Expected added value to be found")
+	}
+	if codec.decodes != 1 {
+		t.Errorf("Expected Add to keep the decoded value, got %d decodes", codec.decodes)
+	}
+	if data, ok := cache.Get("added"); !ok || string(data) != `["eevee"]` {
+		t.Errorf("Expected serialized value in the byte cache, got %q", data)
+	}
+}
+
+func TestRefreshKeepsDecodedValue(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCache(time.Minute, WithClock(clock), WithStaleRetention(time.Hour))
+	defer cache.Close()
+	codec := &countingCodec{}
+	typed := NewTypedCache[[]string](cache, codec)
+
+	cache.AddWithValidators("names", []byte(`["pikachu"]`), time.Minute, Validators{ETag: `"v1"`, LastModified: "yesterday"})
+	if _, found, err := typed.Load("names"); !found || err != nil {
+		t.Fatalf("Load() = %v, %v", found, err)
+	}
+	clock.Advance(2 * time.Minute)
+
+	if !cache.RefreshWithValidators("names", time.Minute, Validators{ETag: `"v2"`}) {
+		t.Fatal("Expected the stale entry to be refreshed")
+	}
+	if names, found, _ := typed.Get("names"); !found || len(names) != 1 {
+		t.Errorf("Expected the refreshed value, got %v (found=%v)", names, found)
+	}
+	if codec.decodes != 1 {
+		t.Errorf("Expected the refresh to keep the decoded value, got %d decodes", codec.decodes)
+	}
+	if validators, _ := cache.Validators("names"); validators != (Validators{ETag: `"v2"`, LastModified: "yesterday"}) {
+		t.Errorf("Expected only the new ETag to replace the old one, got %+v", validators)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 0 {
+		t.Errorf("Expected Load not to count, got %+v", stats)
+	}
+}
+
+func TestTypedCacheReportsDecodeErrors(t *testing.T) {
+	cache := NewCache(time.Minute)
+	defer cache.Close()
+	typed := NewTypedCache[[]string](cache, JSONCodec[[]string]{})
+
+	cache.Add("bad", []byte("{not json"))
+	if _, found, err := typed.Get("bad"); err == nil || found {
+		t.Errorf("Expected a decode error, got found=%v err=%v", found, err)
+	}
+}
@@ -0,0 +1,127 @@
+package pokedex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Store holds caught Pokemon and keeps them in a JSON file so they survive restarts
+type Store struct {
+	mux     sync.RWMutex
+	path    string
+	entries map[string]json.RawMessage
+	names   []string // sorted, so listing the Pokedex needs no sorting
+}
+
+// DefaultPath returns the location of the Pokedex file in the user's config directory
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error locating config directory: %w", err)
+	}
+	return filepath.Join(dir, "pokedex", "pokedex.json"), nil
+}
+
+// NewStore creates a Store backed by the file at path, loading any Pokemon already saved there.
+// An empty path gives a Store that only lives in memory.
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		entries: make(map[string]json.RawMessage),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading pokedex file: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.entries); err != nil {
+		return nil, fmt.Errorf("error decoding pokedex file %s: %w", path, err)
+	}
+	for name := range s.entries {
+		s.names = append(s.names, name)
+	}
+	sort.Strings(s.names)
+	return s, nil
+}
+
+// Get returns the stored data for the named Pokemon
+func (s *Store) Get(name string) ([]byte, bool) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	val, exists := s.entries[name]
+	return val, exists
+}
+
+// Add records a caught Pokemon and writes the Pokedex back to disk
+func (s *Store) Add(name string, val []byte) error {
+	if !json.Valid(val) {
+		return fmt.Errorf("invalid pokemon data for %s", name)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, exists := s.entries[name]; !exists {
+		i := sort.SearchStrings(s.names, name)
+		s.names = append(s.names, "")
+		copy(s.names[i+1:], s.names[i:])
+		s.names[i] = name
+	}
+	s.entries[name] = json.RawMessage(val)
+	return s.save()
+}
+
+// Names returns the names of all caught Pokemon in alphabetical order
+func (s *Store) Names() []string {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	names := make([]string, len(s.names))
+	copy(names, s.names)
+	return names
+}
+
+// save writes the Pokedex to a temporary file and renames it into place,
+// so a crash mid-write never leaves a half-written Pokedex behind.
+// The caller must hold the write lock.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(s.entries)
+	if err != nil {
+		return fmt.Errorf("error serializing pokedex: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("error creating pokedex directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".pokedex-*.json")
+	if err != nil {
+		return fmt.Errorf("error creating pokedex file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing pokedex file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing pokedex file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("error saving pokedex file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package pokedex
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStorePersistsAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pokedex", "pokedex.json")
+
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	if err := store.Add("pikachu", []byte(`{"name":"pikachu"}`)); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := store.Add("bulbasaur", []byte(`{"name":"bulbasaur"}`)); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	reopened, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() on reopen error = %v", err)
+	}
+
+	names := reopened.Names()
+	expected := []string{"bulbasaur", "pikachu"}
+	if len(names) != len(expected) {
+		t.Fatalf("Expected %d names, got %d", len(expected), len(names))
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("Expected name %q at position %d, got %q", expected[i], i, names[i])
+		}
+	}
+
+	if data, ok := reopened.Get("pikachu"); !ok || string(data) != `{"name":"pikachu"}` {
+		t.Errorf("Expected pikachu data to survive reopen, got %q (found=%v)", data, ok)
+	}
+}
+
+func TestStoreRejectsInvalidJSON(t *testing.T) {
+	store, err := NewStore("")
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	if err := store.Add("missingno", []byte("{not json")); err == nil {
+		t.Error("Expected an error for invalid data, got nil")
+	}
+	if _, ok := store.Get("missingno"); ok {
+		t.Error("Expected invalid data not to be stored")
+	}
+}
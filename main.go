@@ -2,12 +2,33 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync"
+
+	"github.com/Specter242/bootpokedex/internal/pokeapi"
+	"github.com/Specter242/bootpokedex/internal/pokecache"
+	"github.com/Specter242/bootpokedex/internal/pokedex"
 )
 
 func main() {
+	cache, client := newClient()
+	defer client.Close()
+	pokeCache, pokeClient = cache, client
+
+	// Ctrl-C cancels the running command instead of killing the process
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	var running interrupter
+	go running.watch(interrupts)
+
 	commands := getCommands()
 	scanner := bufio.NewScanner(os.Stdin)
 	for {
@@ -18,7 +39,8 @@ func main() {
 			break
 		}
 
-		words := cleanInput(scanner.Text())
+		input := scanner.Text()
+		words := cleanInput(input)
 		if len(words) == 0 {
 			continue
 		}
@@ -31,7 +53,9 @@ func main() {
 		}
 
 		var arg string
-		if len(words) > 1 && cmd.requiresArg {
+		if cmd.variadic {
+			arg = strings.Join(strings.Fields(input)[1:], " ")
+		} else if len(words) > 1 && cmd.requiresArg {
 			arg = words[1]
 		}
 
@@ -40,14 +64,18 @@ func main() {
 			continue
 		}
 
-		if !cmd.requiresArg && len(words) > 1 {
+		if !cmd.requiresArg && !cmd.variadic && len(words) > 1 {
 			fmt.Printf("Command '%s' doesn't accept arguments\n", commandName)
 			continue
 		}
 
-		err := cmd.callback(arg)
-		if err != nil {
-			fmt.Println("Error:", err)
+		ctx := running.start()
+		err := cmd.callback(ctx, arg)
+		running.stop()
+		if errors.Is(err, context.Canceled) {
+			fmt.Println("Cancelled")
+		} else if err != nil {
+			fmt.Println("Error:", explainError(commandName, arg, err))
 		}
 
 		if commandName == "exit" {
@@ -56,6 +84,152 @@ func main() {
 	}
 }
 
+// interrupter cancels the command that is running when Ctrl-C is pressed
+type interrupter struct {
+	mux    sync.Mutex
+	cancel context.CancelFunc
+}
+
+// start returns the context for a command that is about to run
+func (i *interrupter) start() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	i.mux.Lock()
+	i.cancel = cancel
+	i.mux.Unlock()
+	return ctx
+}
+
+// stop releases the context of the command that just finished
+func (i *interrupter) stop() {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if i.cancel != nil {
+		i.cancel()
+		i.cancel = nil
+	}
+}
+
+// watch cancels the running command on each interrupt. At the prompt it
+// only reminds the user how to quit.
+func (i *interrupter) watch(interrupts <-chan os.Signal) {
+	for range interrupts {
+		i.mux.Lock()
+		if i.cancel != nil {
+			i.cancel()
+		} else {
+			fmt.Print("\n(type exit or press Ctrl-D to quit)\nPokedex > ")
+		}
+		i.mux.Unlock()
+	}
+}
+
+// explainError describes a command's error for the player, with a hint where one helps
+func explainError(commandName, arg string, err error) string {
+	var httpErr *pokeapi.HTTPError
+	switch {
+	case errors.Is(err, pokeapi.ErrNotFound):
+		switch commandName {
+		case "explore":
+			return fmt.Sprintf("there is no location area called %s. Use map to list them.", arg)
+		case "catch":
+			return fmt.Sprintf("there is no Pokemon called %s. Check the spelling.", arg)
+		}
+		return fmt.Sprintf("%s was not found", arg)
+	case errors.Is(err, pokeapi.ErrNotCaught):
+		return fmt.Sprintf("%v. Try catch %s first.", err, arg)
+	case errors.Is(err, pokeapi.ErrRateLimited):
+		return "PokeAPI is rate limiting requests. Wait a moment and try again."
+	case errors.Is(err, pokeapi.ErrThrottled):
+		return "Too many requests are queued behind the client's rate limit. Wait a moment and try again, or run diagnostics."
+	case errors.Is(err, pokeapi.ErrUnavailable):
+		return "PokeAPI can't be reached right now. Check your connection; cached locations still work."
+	case errors.As(err, &httpErr):
+		return fmt.Sprintf("PokeAPI answered %d %s", httpErr.Status, http.StatusText(httpErr.Status))
+	}
+	return err.Error()
+}
+
+// newClient builds the PokeAPI client with the saved Pokedex and an on-disk response cache.
+// Either one falls back to memory only if it can't be set up.
+// Setting POKEDEX_PREFETCH to "next" or "areas" turns on background prefetching,
+// and setting POKEDEX_LOG_REQUESTS logs every request sent to PokeAPI.
+func newClient() (*pokecache.Cache, *pokeapi.Client) {
+	opts := []pokeapi.Option{
+		pokeapi.WithLogger(log.New(os.Stdout, "Warning: ", 0)),
+		pokeapi.WithRateLimiter(pokeLimiter),
+	}
+
+	store, err := openPokedex()
+	if err != nil {
+		fmt.Println("Warning:", err)
+		fmt.Println("Caught Pokemon will not be saved this session.")
+	} else {
+		opts = append(opts, pokeapi.WithPokedex(store))
+	}
+
+	switch os.Getenv("POKEDEX_PREFETCH") {
+	case "next":
+		opts = append(opts, pokeapi.WithPrefetch(false))
+	case "areas":
+		opts = append(opts, pokeapi.WithPrefetch(true))
+	}
+
+	if os.Getenv("POKEDEX_LOG_REQUESTS") != "" {
+		opts = append(opts, pokeapi.WithRequestLogging(log.New(os.Stdout, "Request: ", 0)))
+	}
+
+	var cacheOpts []pokecache.Option
+	if store, err := openCacheStore(); err != nil {
+		fmt.Println("Warning:", err)
+		fmt.Println("Responses will only be cached in memory this session.")
+	} else if store != nil {
+		cacheOpts = append(cacheOpts, pokecache.WithStore(store))
+	}
+	cache := pokeapi.NewResponseCache(cacheOpts...)
+	opts = append(opts, pokeapi.WithCache(cache))
+
+	return cache, pokeapi.NewClient(pokeAPIBaseURL, opts...)
+}
+
+// openCacheStore opens the response cache backend chosen by POKEDEX_CACHE_STORE:
+// "dir" (the default) for one file per response, "log" for a single append-only
+// log, or "memory" for no persistence. POKEDEX_CACHE_DIR overrides the location.
+// Only the dir store can be shared by several tools at once; the log store
+// must be used by one process at a time.
+func openCacheStore() (pokecache.Store, error) {
+	dir := os.Getenv("POKEDEX_CACHE_DIR")
+	if dir == "" {
+		var err error
+		if dir, err = pokecache.DefaultDiskDir(); err != nil {
+			return nil, err
+		}
+	}
+
+	switch backend := os.Getenv("POKEDEX_CACHE_STORE"); backend {
+	case "", "dir":
+		return pokecache.NewDirStore(dir), nil
+	case "log":
+		store, err := pokecache.OpenLogStore(filepath.Join(dir, "cache.log"))
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case "memory":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown cache store %q", backend)
+	}
+}
+
+// openPokedex loads the saved Pokedex from the user's config directory
+func openPokedex() (*pokedex.Store, error) {
+	path, err := pokedex.DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	return pokedex.NewStore(path)
+}
+
 func cleanInput(text string) []string {
 	// Remove any leading or trailing whitespace
 	text = strings.TrimSpace(text)
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Specter242/bootpokedex/internal/pokeapi"
+	"github.com/Specter242/bootpokedex/internal/pokecache"
 )
 
 // MockClient implements the APIClient interface for testing
@@ -16,6 +22,9 @@ type MockClient struct {
 	shouldError  bool
 	callHistory  []bool // tracks forward/backward calls
 	catchSuccess bool   // determines if catch attempt succeeds
+	pages        int    // number of location pages
+	pageHistory  []int  // tracks jumps to specific pages
+	pageSize     int
 }
 
 func (m *MockClient) GetLocations(directionFWD bool) (*pokeapi.LocationResponse, error) {
@@ -26,6 +35,36 @@ func (m *MockClient) GetLocations(directionFWD bool) (*pokeapi.LocationResponse,
 	return m.locations, nil
 }
 
+func (m *MockClient) GetLocationPage(page int) (*pokeapi.LocationResponse, error) {
+	if m.shouldError {
+		return nil, fmt.Errorf("mock error")
+	}
+	if page < 1 || page > m.pages {
+		return nil, fmt.Errorf("page %d out of range", page)
+	}
+	m.pageHistory = append(m.pageHistory, page)
+	return m.locations, nil
+}
+
+func (m *MockClient) LocationPages() (int, error) {
+	if m.shouldError {
+		return 0, fmt.Errorf("mock error")
+	}
+	return m.pages, nil
+}
+
+func (m *MockClient) PageSize() int {
+	return m.pageSize
+}
+
+func (m *MockClient) SetPageSize(size int) error {
+	if size < 1 {
+		return fmt.Errorf("page size must be at least 1")
+	}
+	m.pageSize = size
+	return nil
+}
+
 func (m *MockClient) Explore(locationName string) (*pokeapi.PokeList, error) {
 	if m.shouldError {
 		return nil, fmt.Errorf("mock error")
@@ -54,11 +93,40 @@ func (m *MockClient) InspectPokemon(pokemonName string) (*pokeapi.Pokemon, error
 		return nil, fmt.Errorf("pokemon name required")
 	}
 	if m.pokemon == nil {
-		return nil, fmt.Errorf("you haven't caught %s yet", pokemonName)
+		return nil, fmt.Errorf("%w: %s", pokeapi.ErrNotCaught, pokemonName)
 	}
 	return m.pokemon, nil
 }
 
+// The Context variants ignore ctx; cancellation is covered in the pokeapi tests
+func (m *MockClient) GetLocationsContext(ctx context.Context, directionFWD bool) (*pokeapi.LocationResponse, error) {
+	return m.GetLocations(directionFWD)
+}
+
+func (m *MockClient) GetLocationPageContext(ctx context.Context, page int) (*pokeapi.LocationResponse, error) {
+	return m.GetLocationPage(page)
+}
+
+func (m *MockClient) LocationPagesContext(ctx context.Context) (int, error) {
+	return m.LocationPages()
+}
+
+func (m *MockClient) ExploreContext(ctx context.Context, locationName string) (*pokeapi.PokeList, error) {
+	return m.Explore(locationName)
+}
+
+func (m *MockClient) CatchContext(ctx context.Context, pokemonName string) (bool, error) {
+	return m.Catch(pokemonName)
+}
+
+func (m *MockClient) InspectPokemonContext(ctx context.Context, pokemonName string) (*pokeapi.Pokemon, error) {
+	return m.InspectPokemon(pokemonName)
+}
+
+func (m *MockClient) GetPokedexContext(ctx context.Context) (*pokeapi.Pokedex, error) {
+	return m.GetPokedex()
+}
+
 // Add GetPokedex method to fulfill the APIClient interface
 func (m *MockClient) GetPokedex() (*pokeapi.Pokedex, error) {
 	if m.shouldError {
@@ -153,7 +221,7 @@ func TestCommandMap(t *testing.T) {
 	pokeClient = mockClient
 	defer func() { pokeClient = originalClient }()
 
-	err := commandMap("")
+	err := commandMap(context.Background(), "")
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -163,6 +231,64 @@ func TestCommandMap(t *testing.T) {
 	}
 }
 
+func TestCommandMapPages(t *testing.T) {
+	mockClient := &MockClient{
+		locations: &pokeapi.LocationResponse{
+			Count: 60,
+			Results: []pokeapi.Location{
+				{Name: "test-location", URL: "test-url"},
+			},
+		},
+		pages: 3,
+	}
+
+	originalClient := pokeClient
+	pokeClient = mockClient
+	defer func() { pokeClient = originalClient }()
+
+	for _, arg := range []string{"first", "last", "page 2", "PAGE 3"} {
+		if err := commandMap(context.Background(), arg); err != nil {
+			t.Errorf("map %s: expected no error, got %v", arg, err)
+		}
+	}
+	want := []int{1, 3, 2, 3}
+	if fmt.Sprint(mockClient.pageHistory) != fmt.Sprint(want) {
+		t.Errorf("Expected pages %v, got %v", want, mockClient.pageHistory)
+	}
+
+	for _, arg := range []string{"page", "page two", "page 4", "sideways"} {
+		if err := commandMap(context.Background(), arg); err == nil {
+			t.Errorf("map %s: expected an error", arg)
+		}
+	}
+	if len(mockClient.callHistory) != 0 {
+		t.Error("Expected page jumps not to step forward or back")
+	}
+}
+
+func TestCommandPageSize(t *testing.T) {
+	mockClient := &MockClient{pageSize: pokeapi.DefaultPageSize}
+
+	originalClient := pokeClient
+	pokeClient = mockClient
+	defer func() { pokeClient = originalClient }()
+
+	if err := commandPageSize(context.Background(), ""); err != nil {
+		t.Errorf("Expected no error showing the page size, got %v", err)
+	}
+	if err := commandPageSize(context.Background(), "50"); err != nil {
+		t.Errorf("Expected no error setting the page size, got %v", err)
+	}
+	if mockClient.pageSize != 50 {
+		t.Errorf("Expected page size 50, got %d", mockClient.pageSize)
+	}
+	for _, arg := range []string{"0", "fifty"} {
+		if err := commandPageSize(context.Background(), arg); err == nil {
+			t.Errorf("pagesize %s: expected an error", arg)
+		}
+	}
+}
+
 func TestCommandMapb(t *testing.T) {
 	mockClient := &MockClient{
 		locations: &pokeapi.LocationResponse{
@@ -177,7 +303,7 @@ func TestCommandMapb(t *testing.T) {
 	pokeClient = mockClient
 	defer func() { pokeClient = originalClient }()
 
-	err := commandMapb("")
+	err := commandMapb(context.Background(), "")
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -188,20 +314,27 @@ func TestCommandMapb(t *testing.T) {
 }
 
 func TestCommandHelp(t *testing.T) {
-	err := commandHelp("")
+	err := commandHelp(context.Background(), "")
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
 }
 
+func TestCommandExit(t *testing.T) {
+	// exit must return to the REPL loop, so main's deferred Close still runs
+	if err := commandExit(context.Background(), ""); err != nil {
+		t.Errorf("commandExit() error = %v", err)
+	}
+}
+
 func TestCommandDescriptions(t *testing.T) {
 	commands := getCommands()
 
 	expectedDescriptions := map[string]string{
 		"help": "Displays a help message",
 		"exit": "Exit the Pokedex",
-		"map":  "Display the next 20 locations",
-		"mapb": "Display the previous 20 locations",
+		"map":  "Display the next page of locations. Usage: map [first | last | page <n>]",
+		"mapb": "Display the previous page of locations",
 	}
 
 	for cmd, expectedDesc := range expectedDescriptions {
@@ -253,7 +386,7 @@ func TestCommandExplore(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := commandExplore(tt.arg)
+			err := commandExplore(context.Background(), tt.arg)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("commandExplore() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -331,7 +464,7 @@ func TestCommandInspect(t *testing.T) {
 			}
 			pokeClient = mockClient
 
-			err := commandInspect(tt.arg)
+			err := commandInspect(context.Background(), tt.arg)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("commandInspect() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -353,15 +486,94 @@ func TestCommandPokedex(t *testing.T) {
 	pokeClient = mockClient
 	defer func() { pokeClient = originalClient }()
 
-	err := commandPokedex("")
+	err := commandPokedex(context.Background(), "")
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
 
 	// Test with error
 	mockClient.shouldError = true
-	err = commandPokedex("")
+	err = commandPokedex(context.Background(), "")
 	if err == nil {
 		t.Error("Expected an error, got nil")
 	}
 }
+
+func TestCommandCache(t *testing.T) {
+	originalCache := pokeCache
+	pokeCache = pokecache.NewCache(time.Minute)
+	defer func() {
+		pokeCache.Close()
+		pokeCache = originalCache
+	}()
+
+	pokeCache.Add("https://pokeapi.co/api/v2/location-area", []byte("data"))
+
+	for _, arg := range []string{"stats", "keys", "keys https://pokeapi.co", "clear"} {
+		if err := commandCache(context.Background(), arg); err != nil {
+			t.Errorf("commandCache(%q) error = %v", arg, err)
+		}
+	}
+
+	if stats := pokeCache.Stats(); stats.Entries != 0 {
+		t.Errorf("Expected cache clear to remove all entries, got %d", stats.Entries)
+	}
+
+	snapshot := filepath.Join(t.TempDir(), "cache.json")
+	pokeCache.Add("https://pokeapi.co/api/v2/pokemon/pikachu", []byte("data"))
+	if err := commandCache(context.Background(), "export "+snapshot); err != nil {
+		t.Fatalf("cache export error = %v", err)
+	}
+	pokeCache.Clear()
+	if err := commandCache(context.Background(), "import "+snapshot); err != nil {
+		t.Fatalf("cache import error = %v", err)
+	}
+	if _, ok := pokeCache.Get("https://pokeapi.co/api/v2/pokemon/pikachu"); !ok {
+		t.Error("Expected cache import to restore exported entries")
+	}
+
+	for _, arg := range []string{"", "bogus", "export", "import a b"} {
+		if err := commandCache(context.Background(), arg); err == nil {
+			t.Errorf("commandCache(%q): expected an error, got nil", arg)
+		}
+	}
+}
+
+func TestCommandDiagnostics(t *testing.T) {
+	originalLimiter := pokeLimiter
+	pokeLimiter = pokeapi.NewRateLimiter(5, 1)
+	defer func() { pokeLimiter = originalLimiter }()
+
+	if err := commandDiagnostics(context.Background(), ""); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestExplainError(t *testing.T) {
+	tests := []struct {
+		command string
+		arg     string
+		err     error
+		want    string
+	}{
+		{"catch", "pikachoo", &pokeapi.HTTPError{Status: http.StatusNotFound}, "there is no Pokemon called pikachoo. Check the spelling."},
+		{"explore", "nowhere", &pokeapi.HTTPError{Status: http.StatusNotFound}, "there is no location area called nowhere. Use map to list them."},
+		{"map", "", &pokeapi.HTTPError{Status: http.StatusTooManyRequests}, "PokeAPI is rate limiting requests. Wait a moment and try again."},
+		{"map", "", fmt.Errorf("%w: error fetching", pokeapi.ErrUnavailable), "PokeAPI can't be reached right now. Check your connection; cached locations still work."},
+		{"map", "", fmt.Errorf("%w: context deadline exceeded", pokeapi.ErrThrottled), "Too many requests are queued behind the client's rate limit. Wait a moment and try again, or run diagnostics."},
+		{"map", "", &pokeapi.HTTPError{Status: http.StatusForbidden}, "PokeAPI answered 403 Forbidden"},
+		{"pokedex", "", fmt.Errorf("disk full"), "disk full"},
+	}
+
+	for _, tt := range tests {
+		if got := explainError(tt.command, tt.arg, tt.err); got != tt.want {
+			t.Errorf("explainError(%q, %q, %v) = %q, want %q", tt.command, tt.arg, tt.err, got, tt.want)
+		}
+	}
+
+	mockClient := &MockClient{}
+	_, err := mockClient.InspectPokemon("mew")
+	if got := explainError("inspect", "mew", err); !strings.Contains(got, "Try catch mew first.") {
+		t.Errorf("Expected a hint to catch mew, got %q", got)
+	}
+}